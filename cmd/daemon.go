@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+var daemonTimeout time.Duration
+
+// pidPath pid 文件路径,与 IPC socket 同目录
+func pidPath() string {
+	return strings.TrimSuffix(defOpt.ipcPath, filepath.Ext(defOpt.ipcPath)) + ".pid"
+}
+
+// waitIPC 等待 IPC 可以响应请求
+func waitIPC(timeout time.Duration, exited <-chan error) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := callIPC("stats", nil, nil, time.Second); err == nil {
+			return nil
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("process exited: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return errors.New("wait ipc answer timeout")
+}
+
+// waitExit 等待进程退出
+func waitExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// startDaemon 以守护进程方式启动服务,等待 IPC socket 就绪后返回 pid
+func startDaemon(timeout time.Duration, args []string) (int, error) {
+	if pid, ok := runningPid(); ok {
+		return 0, fmt.Errorf("already running, pid %d", pid)
+	}
+	if err := os.MkdirAll(defOpt.logPath, 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(filepath.Join(defOpt.logPath, tools.CurrentName()+".out"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return 0, err
+	}
+	defer null.Close()
+
+	c := exec.Command(filepath.Join(tools.CurrentDir(), tools.CurrentName()), args...)
+	c.Dir = tools.CurrentDir()
+	// 守护进程使用与当前命令相同的 IPC socket
+	c.Env = append(os.Environ(), envIpcPath+"="+defOpt.ipcPath, envInstance+"="+instance)
+	c.Stdin = null
+	c.Stdout = out
+	c.Stderr = out
+	c.SysProcAttr = daemonAttr()
+	if err = c.Start(); err != nil {
+		return 0, err
+	}
+	pid := c.Process.Pid
+	exited := make(chan error, 1)
+	go func() {
+		exited <- c.Wait()
+	}()
+	if err = waitIPC(timeout, exited); err != nil {
+		c.Process.Kill()
+		return 0, fmt.Errorf("daemon start failed, see %s: %w", out.Name(), err)
+	}
+	return pid, nil
+}
+
+// stopDaemon 停止守护进程,等待进程退出
+func stopDaemon(timeout time.Duration) error {
+	pid, ok := runningPid()
+	if !ok {
+		return errors.New("not running")
+	}
+	// 持有锁的进程尚未写入 pid 或 pid 文件损坏
+	if pid <= 0 {
+		return errors.New("running but pid unknown")
+	}
+	if err := terminate(pid); err != nil {
+		return err
+	}
+	if !waitExit(pid, timeout) {
+		return fmt.Errorf("wait process %d exit timeout", pid)
+	}
+	return nil
+}
+
+// ServerCmd represents the server command
+var svcCmd = &cobra.Command{
+	Use:   "nc [-- args...]",
+	Short: "backgroud service",
+	Long:  `backgroud Service, args after -- are passed to service`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pid, err := startDaemon(daemonTimeout, args)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backgroup started =>", pid)
+		return nil
+	},
+}
+
+var ncStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "stop",
+	Long:  `stop backgroud service`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := stopDaemon(daemonTimeout); err != nil {
+			return err
+		}
+		fmt.Println("backgroup stopped")
+		return nil
+	},
+}
+
+var ncStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "status",
+	Long:  `status backgroud service`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pid, ok := runningPid()
+		if !ok {
+			return errors.New("stopped")
+		}
+		if _, err := CallIPC("stats", nil); err != nil {
+			return fmt.Errorf("pid %d running, ipc not answering: %w", pid, err)
+		}
+		fmt.Println("running pid", pid)
+		return nil
+	},
+}
+
+func init() {
+	svcCmd.PersistentFlags().DurationVar(&daemonTimeout, "timeout", 10*time.Second, "wait timeout")
+	for _, c := range []*cobra.Command{svcCmd, ncStopCmd, ncStatusCmd} {
+		c.SilenceUsage = true
+	}
+	svcCmd.AddCommand(ncStopCmd)
+	svcCmd.AddCommand(ncStatusCmd)
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"syscall"
+)
+
+// daemonAttr 创建新会话,脱离终端
+func daemonAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// InitSystem 服务管理后端(systemd,SysV,OpenRC,supervisord)
+type InitSystem interface {
+	// Name 后端名称,用于 --init 参数
+	Name() string
+	// Detect 当前系统是否使用该后端
+	Detect() bool
+	// Path 服务配置文件路径
+	Path(name string) string
+	// Render 生成服务配置文件内容,不支持的配置项忽略
+	Render(name string, u UnitOptions) ([]byte, error)
+	// Install 写入配置文件并设置开机启动
+	Install(name string, data []byte) error
+	// Uninstall 取消开机启动并删除配置文件
+	Uninstall(name string) error
+	// Command start/stop/restart/status 对应的命令
+	Command(action, name string) []string
+}
+
+// 按探测优先级排列
+var initSystems = []InitSystem{systemdInit{}, supervisorInit{}, openrcInit{}, sysvInit{}}
+
+var initName string
+
+// RegisterInitSystem 注册服务管理后端,优先于内置后端探测,同名时替换内置后端
+func RegisterInitSystem(s InitSystem) {
+	for i, v := range initSystems {
+		if v.Name() == s.Name() {
+			initSystems[i] = s
+			return
+		}
+	}
+	initSystems = append([]InitSystem{s}, initSystems...)
+}
+
+// initSystem 返回 --init 指定或自动探测的后端
+func initSystem() (InitSystem, error) {
+	if userMode {
+		// 用户服务仅支持 systemd
+		if initName != "" && initName != "systemd" {
+			return nil, fmt.Errorf("--user only supported by systemd")
+		}
+		return systemdInit{user: true}, nil
+	}
+	var names []string
+	for _, s := range initSystems {
+		if initName == "" && s.Detect() || initName == s.Name() {
+			return s, nil
+		}
+		names = append(names, s.Name())
+	}
+	if initName == "" {
+		return nil, fmt.Errorf("no supported init system found, use --init to specify one of %s", strings.Join(names, ","))
+	}
+	return nil, fmt.Errorf("unknown init system %q, supported: %s", initName, strings.Join(names, ","))
+}
+
+// pid1 返回 1 号进程名
+func pid1() string {
+	data, err := os.ReadFile("/proc/1/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func hasCmd(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// execArgs 服务启动命令及参数
+func execArgs(u UnitOptions) []string {
+	return append([]string{filepath.Join(tools.CurrentDir(), tools.CurrentName())}, u.Args...)
+}
+
+// shellQuote 生成 sh 单引号字符串
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\$`!*?[]{}()<>|&;#~") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellJoin(args []string) string {
+	list := make([]string, len(args))
+	for i, a := range args {
+		list[i] = shellQuote(a)
+	}
+	return strings.Join(list, " ")
+}
+
+// shellEnv 生成 sh 脚本中加载环境变量的语句
+func shellEnv(u UnitOptions) string {
+	var b strings.Builder
+	if len(u.EnvFiles) > 0 {
+		// 环境变量文件中的变量同样传给服务
+		b.WriteString("set -a\n")
+	}
+	for _, f := range u.EnvFiles {
+		if strings.HasPrefix(f, "-") {
+			f = shellQuote(f[1:])
+			fmt.Fprintf(&b, "[ -f %s ] && . %s\n", f, f)
+		} else {
+			fmt.Fprintf(&b, ". %s || exit 1\n", shellQuote(f))
+		}
+	}
+	if len(u.EnvFiles) > 0 {
+		b.WriteString("set +a\n")
+	}
+	for _, e := range u.Env {
+		k, v, _ := strings.Cut(e, "=")
+		fmt.Fprintf(&b, "export %s=%s\n", k, shellQuote(v))
+	}
+	return b.String()
+}
+
+func init() {
+	for _, c := range []*cobra.Command{installCmd, uninstallCmd, startCmd, stopCmd, restartCmd, statusCmd} {
+		c.Flags().StringVar(&initName, "init", "", "init system: systemd|sysv|openrc|supervisord, auto detect if empty")
+	}
+}
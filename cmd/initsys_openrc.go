@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// openrcData OpenRC 脚本模板数据
+type openrcData struct {
+	UnitOptions
+	Name        string
+	Command     string
+	CommandArgs string
+	WorkDir     string
+	User        string
+	Log         string
+	Env         string
+	StopWait    int
+}
+
+var openrcTmpl = template.Must(template.New("openrc").Parse(`#!/sbin/openrc-run
+
+description={{.Description}}
+command={{.Command}}
+{{- if .CommandArgs}}
+command_args={{.CommandArgs}}
+{{- end}}
+command_background=true
+pidfile="/run/${RC_SVCNAME}.pid"
+directory={{.WorkDir}}
+{{- if .User}}
+command_user={{.User}}
+{{- end}}
+output_log={{.Log}}
+error_log={{.Log}}
+retry="TERM/{{.StopWait}}/KILL/5"
+{{- if or .LimitNOFILE .LimitNPROC}}
+rc_ulimit="{{if .LimitNOFILE}}-n {{.LimitNOFILE}}{{end}}{{if and .LimitNOFILE .LimitNPROC}} {{end}}{{if .LimitNPROC}}-u {{.LimitNPROC}}{{end}}"
+{{- end}}
+extra_started_commands="reload"
+{{.Env}}
+depend() {
+	need net
+}
+
+reload() {
+	ebegin "Reloading ${RC_SVCNAME}"
+	"$command" reload
+	eend $?
+}
+`))
+
+// openrcInit OpenRC 后端
+type openrcInit struct{}
+
+func (openrcInit) Name() string {
+	return "openrc"
+}
+
+func (openrcInit) Detect() bool {
+	return tools.DirExists("/run/openrc") && hasCmd("openrc-run")
+}
+
+func (openrcInit) Path(name string) string {
+	return "/etc/init.d/" + name
+}
+
+func (openrcInit) Render(name string, u UnitOptions) ([]byte, error) {
+	if u.Description == "" {
+		u.Description = name
+	}
+	u.Env = instanceEnv(u.Env)
+	args := execArgs(u)
+	u.Description = shellQuote(u.Description)
+	user := u.User
+	if user != "" && u.Group != "" {
+		user += ":" + u.Group
+	}
+	if user != "" {
+		user = shellQuote(user)
+	}
+	var cmdArgs string
+	if len(args) > 1 {
+		// openrc 通过 eval 展开 command_args
+		cmdArgs = shellQuote(shellJoin(args[1:]))
+	}
+	var buf bytes.Buffer
+	err := openrcTmpl.Execute(&buf, openrcData{
+		UnitOptions: u,
+		Name:        name,
+		Command:     shellQuote(args[0]),
+		CommandArgs: cmdArgs,
+		WorkDir:     shellQuote(tools.CurrentDir()),
+		User:        user,
+		Log:         shellQuote(filepath.Join(defOpt.logPath, name+".out")),
+		Env:         shellEnv(u),
+		StopWait:    int(defOpt.shutdownTimeout.Seconds()) + 5,
+	})
+	return buf.Bytes(), err
+}
+
+func (s openrcInit) Install(name string, data []byte) error {
+	if err := os.WriteFile(s.Path(name), data, 0755); err != nil {
+		return err
+	}
+	return run("rc-update", "add", name, "default")
+}
+
+func (s openrcInit) Uninstall(name string) error {
+	run("rc-update", "del", name, "default")
+	if err := os.Remove(s.Path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (openrcInit) Command(action, name string) []string {
+	return []string{"rc-service", name, action}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// supervisorData supervisord 配置模板数据
+type supervisorData struct {
+	Name        string
+	Command     string
+	WorkDir     string
+	User        string
+	Env         string
+	AutoRestart string
+	StopWait    int
+	Log         string
+}
+
+var supervisorTmpl = template.Must(template.New("supervisor").Parse(`[program:{{.Name}}]
+command={{.Command}}
+directory={{.WorkDir}}
+autostart=true
+autorestart={{.AutoRestart}}
+startsecs=1
+stopsignal=TERM
+stopwaitsecs={{.StopWait}}
+{{- if .User}}
+user={{.User}}
+{{- end}}
+{{- if .Env}}
+environment={{.Env}}
+{{- end}}
+stdout_logfile={{.Log}}
+redirect_stderr=true
+`))
+
+// supervisorInit supervisord 后端,服务以前台方式运行
+type supervisorInit struct{}
+
+func (supervisorInit) Name() string {
+	return "supervisord"
+}
+
+func (supervisorInit) Detect() bool {
+	if pid1() == "supervisord" {
+		return true
+	}
+	if !hasCmd("supervisorctl") {
+		return false
+	}
+	for _, sock := range []string{"/run/supervisor.sock", "/var/run/supervisor.sock", "/var/run/supervisor/supervisor.sock", "/tmp/supervisor.sock"} {
+		if tools.FileExists(sock) {
+			return true
+		}
+	}
+	return false
+}
+
+func (supervisorInit) Path(name string) string {
+	// RHEL 系使用 supervisord.d/*.ini
+	if !tools.DirExists("/etc/supervisor/conf.d") && tools.DirExists("/etc/supervisord.d") {
+		return "/etc/supervisord.d/" + name + ".ini"
+	}
+	return "/etc/supervisor/conf.d/" + name + ".conf"
+}
+
+// supervisorEscape supervisord 配置中 % 需要转义
+func supervisorEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+func (supervisorInit) Render(name string, u UnitOptions) ([]byte, error) {
+	u.Env = instanceEnv(u.Env)
+	args := execArgs(u)
+	for i, a := range args {
+		args[i] = quoteArg(a)
+	}
+	var env []string
+	for _, e := range u.Env {
+		k, v, _ := strings.Cut(e, "=")
+		env = append(env, k+"="+strconv.Quote(v))
+	}
+	restart := "unexpected"
+	switch u.Restart {
+	case "no", "":
+		restart = "false"
+	case "always":
+		restart = "true"
+	}
+	var buf bytes.Buffer
+	err := supervisorTmpl.Execute(&buf, supervisorData{
+		Name:        name,
+		Command:     supervisorEscape(strings.Join(args, " ")),
+		WorkDir:     supervisorEscape(tools.CurrentDir()),
+		User:        u.User,
+		Env:         supervisorEscape(strings.Join(env, ",")),
+		AutoRestart: restart,
+		StopWait:    int(defOpt.shutdownTimeout.Seconds()) + 5,
+		Log:         supervisorEscape(filepath.Join(defOpt.logPath, name+".out")),
+	})
+	return buf.Bytes(), err
+}
+
+func (s supervisorInit) Install(name string, data []byte) error {
+	path := s.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(defOpt.logPath, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if err := run("supervisorctl", "reread"); err != nil {
+		return err
+	}
+	return run("supervisorctl", "update", name)
+}
+
+func (s supervisorInit) Uninstall(name string) error {
+	if err := os.Remove(s.Path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	run("supervisorctl", "reread")
+	return run("supervisorctl", "update", name)
+}
+
+func (supervisorInit) Command(action, name string) []string {
+	return []string{"supervisorctl", action, name}
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// unitData systemd unit 模板数据
+type unitData struct {
+	UnitOptions
+	WorkDir   string
+	ExecStart string
+	// WithNotify/WithWatchdog 时使用 Type=notify
+	Notify bool
+	// watchdog 超时秒数
+	WatchdogSec int
+	// 用户服务,IPC socket 位于 $XDG_RUNTIME_DIR(%t)
+	UserMode bool
+	Name     string
+	// 多实例模板 name@.service
+	Template bool
+}
+
+// unitTmpl Type=notify 时平滑升级后新进程通过 MAINPID 成为主进程
+var unitTmpl = template.Must(template.New("unit").Parse(`[Unit]
+Description={{.Description}}
+{{- range .After}}
+After={{.}}
+{{- end}}
+{{- range .Wants}}
+Wants={{.}}
+{{- end}}
+
+[Service]
+{{- if .Notify}}
+Type=notify
+NotifyAccess=all
+{{- else}}
+Type=simple
+{{- end}}
+{{- if .WatchdogSec}}
+WatchdogSec={{.WatchdogSec}}
+{{- end}}
+WorkingDirectory={{.WorkDir}}
+ExecStart={{.ExecStart}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+{{- if .Group}}
+Group={{.Group}}
+{{- end}}
+{{- range .EnvFiles}}
+EnvironmentFile={{.}}
+{{- end}}
+{{- range .Env}}
+Environment="{{.}}"
+{{- end}}
+{{- if .Template}}
+Environment="ZYCLI_INSTANCE=%i"
+{{- end}}
+{{- if .UserMode}}
+Environment="ZYCLI_IPC=%t/{{.Name}}.ipc"
+{{- end}}
+{{- if .Restart}}
+Restart={{.Restart}}
+RestartSec={{.RestartSec}}
+{{- end}}
+{{- if .LimitNOFILE}}
+LimitNOFILE={{.LimitNOFILE}}
+{{- end}}
+{{- if .LimitNPROC}}
+LimitNPROC={{.LimitNPROC}}
+{{- end}}
+{{- if .MemoryMax}}
+MemoryMax={{.MemoryMax}}
+{{- end}}
+{{- if .CPUQuota}}
+CPUQuota={{.CPUQuota}}
+{{- end}}
+{{- if .ProtectSystem}}
+ProtectSystem={{.ProtectSystem}}
+{{- end}}
+{{- if .NoNewPrivileges}}
+NoNewPrivileges=true
+{{- end}}
+
+[Install]
+WantedBy={{if .UserMode}}default.target{{else}}multi-user.target{{end}}
+`))
+
+// quoteArg 参数包含空白或引号时加引号
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// systemdArg ExecStart 参数,转义 systemd 的 % 说明符和 $ 变量展开
+func systemdArg(s string) string {
+	return strings.NewReplacer("%", "%%", "$", "$$").Replace(quoteArg(s))
+}
+
+// systemdEnv Environment="..." 中的值,转义引号,反斜杠和 % 说明符
+// Environment 不展开 $,不需要转义
+func systemdEnv(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(s)
+}
+
+// systemdInit systemd 后端,user 为 true 时使用 systemctl --user 管理用户服务
+type systemdInit struct {
+	user bool
+}
+
+func (systemdInit) Name() string {
+	return "systemd"
+}
+
+func (systemdInit) Detect() bool {
+	return tools.DirExists("/run/systemd/system")
+}
+
+func (s systemdInit) Path(name string) string {
+	// 多实例共用模板 name@.service
+	if i := strings.Index(name, "@"); i > 0 {
+		name = name[:i+1]
+	}
+	if s.user {
+		dir, _ := os.UserConfigDir()
+		return filepath.Join(dir, "systemd", "user", name+".service")
+	}
+	return "/etc/systemd/system/" + name + ".service"
+}
+
+func (s systemdInit) Render(name string, u UnitOptions) ([]byte, error) {
+	template := strings.Contains(name, "@")
+	if template {
+		name = name[:strings.Index(name, "@")+1] + "%i"
+	}
+	if u.Description == "" {
+		u.Description = name
+	}
+	if s.user {
+		// 用户服务不能切换用户
+		u.User, u.Group = "", ""
+	}
+	args := execArgs(u)
+	for i, a := range args {
+		args[i] = systemdArg(a)
+	}
+	env := make([]string, len(u.Env))
+	for i, e := range u.Env {
+		env[i] = systemdEnv(e)
+	}
+	u.Env = env
+	var buf bytes.Buffer
+	err := unitTmpl.Execute(&buf, unitData{
+		UnitOptions: u,
+		WorkDir:     strings.ReplaceAll(tools.CurrentDir(), "%", "%%"),
+		ExecStart:   strings.Join(args, " "),
+		Notify:      defOpt.notify,
+		WatchdogSec: int((defOpt.watchdog + time.Second - 1) / time.Second),
+		UserMode:    s.user,
+		Name:        name,
+		Template:    template,
+	})
+	return buf.Bytes(), err
+}
+
+// systemctl 命令参数
+func (s systemdInit) systemctl(args ...string) []string {
+	if s.user {
+		args = append([]string{"--user"}, args...)
+	}
+	return append([]string{"systemctl"}, args...)
+}
+
+func (s systemdInit) Install(name string, data []byte) error {
+	path := s.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	c := s.systemctl("daemon-reload")
+	if err := run(c[0], c[1:]...); err != nil {
+		return err
+	}
+	c = s.systemctl("enable", name+".service")
+	return run(c[0], c[1:]...)
+}
+
+func (s systemdInit) Uninstall(name string) error {
+	c := s.systemctl("disable", name+".service")
+	run(c[0], c[1:]...)
+	if s.otherInstances(name) {
+		return nil
+	}
+	if err := os.Remove(s.Path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c = s.systemctl("daemon-reload")
+	return run(c[0], c[1:]...)
+}
+
+// otherInstances 是否还有其他已启用的实例使用同一模板
+func (s systemdInit) otherInstances(name string) bool {
+	i := strings.Index(name, "@")
+	if i <= 0 {
+		return false
+	}
+	list, _ := filepath.Glob(filepath.Join(filepath.Dir(s.Path(name)), "*.wants", name[:i+1]+"*.service"))
+	for _, f := range list {
+		if filepath.Base(f) != name+".service" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s systemdInit) Command(action, name string) []string {
+	return s.systemctl(action, name+".service")
+}
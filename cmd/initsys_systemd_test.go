@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemdEscape(t *testing.T) {
+	args := map[string]string{
+		"--port":         "--port",
+		"a b":            `"a b"`,
+		"100%":           "100%%",
+		"$HOME":          "$$HOME",
+		`say "hi" $USER`: `"say \"hi\" $$USER"`,
+	}
+	for in, want := range args {
+		if got := systemdArg(in); got != want {
+			t.Fatalf("arg %q got %q", in, got)
+		}
+	}
+	envs := map[string]string{
+		"KEY=v":           "KEY=v",
+		`KEY=a "b" c\d`:   `KEY=a \"b\" c\\d`,
+		"KEY=50%":         "KEY=50%%",
+		"KEY=$NOT_EXPAND": "KEY=$NOT_EXPAND",
+	}
+	for in, want := range envs {
+		if got := systemdEnv(in); got != want {
+			t.Fatalf("env %q got %q", in, got)
+		}
+	}
+}
+
+func TestSystemdNotifyType(t *testing.T) {
+	old := defOpt.notify
+	defer func() { defOpt.notify = old }()
+	for _, notify := range []bool{false, true} {
+		defOpt.notify = notify
+		data, err := systemdInit{}.Render("app", UnitOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		unit := string(data)
+		if got := strings.Contains(unit, "Type=notify\nNotifyAccess=all\n"); got != notify {
+			t.Fatal(unit)
+		}
+		if got := strings.Contains(unit, "Type=simple\n"); got == notify {
+			t.Fatal(unit)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"text/template"
+
+	"github.com/zhiyin2021/zycli/tools"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// sysvData SysV init 脚本模板数据
+type sysvData struct {
+	UnitOptions
+	Name     string
+	WorkDir  string
+	Bin      string
+	Env      string
+	StartCmd string
+}
+
+// 通过 nc 子命令以守护进程方式启动和停止
+var sysvTmpl = template.Must(template.New("sysv").Parse(`#!/bin/sh
+### BEGIN INIT INFO
+# Provides:          {{.Name}}
+# Required-Start:    $network $remote_fs
+# Required-Stop:     $network $remote_fs
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: {{.Description}}
+### END INIT INFO
+
+BIN={{.Bin}}
+cd {{.WorkDir}} || exit 1
+{{.Env}}
+start() {
+{{- if .LimitNOFILE}}
+	ulimit -n {{.LimitNOFILE}} 2>/dev/null
+{{- end}}
+{{- if .LimitNPROC}}
+	ulimit -u {{.LimitNPROC}} 2>/dev/null || ulimit -p {{.LimitNPROC}} 2>/dev/null
+{{- end}}
+	{{.StartCmd}}
+}
+
+case "$1" in
+start)
+	start
+	;;
+stop)
+	"$BIN" nc stop
+	;;
+restart)
+	"$BIN" nc stop
+	start
+	;;
+status)
+	"$BIN" nc status
+	;;
+reload)
+	"$BIN" reload
+	;;
+*)
+	echo "Usage: $0 {start|stop|restart|status|reload}"
+	exit 2
+	;;
+esac
+`))
+
+// sysvInit SysV init 脚本后端
+type sysvInit struct{}
+
+func (sysvInit) Name() string {
+	return "sysv"
+}
+
+func (sysvInit) Detect() bool {
+	return tools.DirExists("/etc/init.d")
+}
+
+func (sysvInit) Path(name string) string {
+	return "/etc/init.d/" + name
+}
+
+func (sysvInit) Render(name string, u UnitOptions) ([]byte, error) {
+	if u.Description == "" {
+		u.Description = name
+	}
+	u.Env = instanceEnv(u.Env)
+	args := execArgs(u)
+	start := []string{args[0], "nc"}
+	if len(args) > 1 {
+		start = append(append(start, "--"), args[1:]...)
+	}
+	cmd := shellJoin(start)
+	if u.User != "" {
+		cmd = "su -s /bin/sh -c " + shellQuote(cmd) + " " + shellQuote(u.User)
+	}
+	var buf bytes.Buffer
+	err := sysvTmpl.Execute(&buf, sysvData{
+		UnitOptions: u,
+		Name:        name,
+		WorkDir:     shellQuote(tools.CurrentDir()),
+		Bin:         shellQuote(args[0]),
+		Env:         shellEnv(u),
+		StartCmd:    cmd,
+	})
+	return buf.Bytes(), err
+}
+
+func (s sysvInit) Install(name string, data []byte) error {
+	if err := os.WriteFile(s.Path(name), data, 0755); err != nil {
+		return err
+	}
+	switch {
+	case hasCmd("update-rc.d"):
+		return run("update-rc.d", name, "defaults")
+	case hasCmd("chkconfig"):
+		return run("chkconfig", "--add", name)
+	}
+	logger.Println("update-rc.d or chkconfig not found, service will not start on boot")
+	return nil
+}
+
+func (s sysvInit) Uninstall(name string) error {
+	switch {
+	case hasCmd("update-rc.d"):
+		run("update-rc.d", "-f", name, "remove")
+	case hasCmd("chkconfig"):
+		run("chkconfig", "--del", name)
+	}
+	if err := os.Remove(s.Path(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s sysvInit) Command(action, name string) []string {
+	return []string{s.Path(name), action}
+}
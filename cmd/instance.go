@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// envInstance 实例名,服务配置通过该变量传给进程
+const envInstance = "ZYCLI_INSTANCE"
+
+// instance 实例名,同一程序可按实例安装多个服务
+var instance string
+
+// svcName 服务名,有实例时为 name@instance
+func svcName() string {
+	if instance == "" {
+		return tools.CurrentName()
+	}
+	return tools.CurrentName() + "@" + instance
+}
+
+// instanceFile 在扩展名前插入 @instance, 如 app.ipc => app@foo.ipc
+func instanceFile(path string) string {
+	if instance == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "@" + instance + ext
+}
+
+// instanceEnv 服务配置中追加实例环境变量
+func instanceEnv(env []string) []string {
+	if instance == "" {
+		return env
+	}
+	return append(env[:len(env):len(env)], envInstance+"="+instance)
+}
+
+// validInstance 实例名会作为文件名和服务名的一部分,只允许字母,数字,_ . -,且不能以 . 开头
+func validInstance(name string) error {
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid instance name %q, must not start with '.'", name)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return fmt.Errorf("invalid instance name %q, only [A-Za-z0-9_.-] allowed", name)
+		}
+	}
+	return nil
+}
+
+// resolveInstance 按 --instance,$ZYCLI_INSTANCE 确定实例,并使用实例独立的 IPC socket 和日志目录
+func resolveInstance() error {
+	if instance == "" {
+		instance = os.Getenv(envInstance)
+	}
+	if instance == "" {
+		return nil
+	}
+	if err := validInstance(instance); err != nil {
+		return err
+	}
+	defOpt.ipcPath = instanceFile(defOpt.ipcPath)
+	defOpt.logPath = filepath.Join(defOpt.logPath, instance) + "/"
+	return nil
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&instance, "instance", "", "service instance name, each instance has its own ipc, log, config and dbg file")
+}
@@ -0,0 +1,16 @@
+package cmd
+
+import "testing"
+
+func TestValidInstance(t *testing.T) {
+	for _, name := range []string{"foo", "Foo-1", "a_b.c", "8080", "a..b"} {
+		if err := validInstance(name); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	for _, name := range []string{".", "..", ".foo", "../x", "a/b", `a\b`, "a b", "a@b", "a%i", "中文", "a\n"} {
+		if err := validInstance(name); err == nil {
+			t.Fatal("expect error", name)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// IPC 错误码
+const (
+	IPC_OK          = 0
+	IPC_BAD_REQUEST = 400
+	IPC_FORBIDDEN   = 403
+	IPC_NOT_FOUND   = 404
+	IPC_INTERNAL    = 500
+)
+
+type IPCArgType string
+
+// IPC 参数类型
+const (
+	ARG_STRING   IPCArgType = "string"
+	ARG_INT      IPCArgType = "int"
+	ARG_BOOL     IPCArgType = "bool"
+	ARG_DURATION IPCArgType = "duration"
+)
+
+// maxFrameSize 单帧最大长度
+const maxFrameSize = 64 * 1024 * 1024
+
+// IPCArg IPC 命令参数声明,同时用于生成 ctl 子命令的 flag
+type IPCArg struct {
+	Name    string
+	Type    IPCArgType
+	Default string
+	Usage   string
+}
+
+// IPCHandler IPC 命令处理器
+// Uids/Gids 为允许调用的用户和组,都为空时只允许 root 和服务进程所属用户调用
+type IPCHandler struct {
+	Short  string
+	Args   []IPCArg
+	Uids   []int
+	Gids   []int
+	Handle func(req *IPCRequest) (any, error)
+}
+
+type IPCRequest struct {
+	Id   string            `json:"id"`
+	Cmd  string            `json:"cmd"`
+	Args map[string]string `json:"args,omitempty"`
+
+	cred *IPCCred
+}
+
+// IPCCred 调用方进程凭证,仅 linux/darwin/freebsd 下可用
+type IPCCred struct {
+	Pid    int
+	Uid    int
+	Gid    int
+	Groups []int
+}
+
+// IPCResponse IPC 响应
+// Stream 为 true 时,后续跟随若干二进制数据帧,以空帧结束,最后再发送一个响应帧表示结果
+type IPCResponse struct {
+	Id     string          `json:"id"`
+	Code   int             `json:"code"`
+	Msg    string          `json:"msg,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Stream bool            `json:"stream,omitempty"`
+}
+
+// IPCStream 流式响应,处理器返回该类型时写入的数据以二进制帧发送给调用方
+type IPCStream func(w io.Writer) error
+
+type IPCError struct {
+	Code int
+	Msg  string
+}
+
+var (
+	ipcMu       sync.RWMutex
+	ipcHandlers = map[string]*IPCHandler{}
+)
+
+func NewIPCError(code int, msg string) *IPCError {
+	return &IPCError{Code: code, Msg: msg}
+}
+
+func (e *IPCError) Error() string {
+	return fmt.Sprintf("ipc error %d: %s", e.Code, e.Msg)
+}
+
+// RegisterIPC 注册 IPC 命令,同名命令会被覆盖
+// 需要在 Execute 之前注册,才能自动生成 `app ctl <name>` 子命令
+func RegisterIPC(name string, handler IPCHandler) {
+	if handler.Handle == nil {
+		panic("ipc handler is nil: " + name)
+	}
+	ipcMu.Lock()
+	defer ipcMu.Unlock()
+	ipcHandlers[name] = &handler
+}
+
+func getIPC(name string) *IPCHandler {
+	ipcMu.RLock()
+	defer ipcMu.RUnlock()
+	return ipcHandlers[name]
+}
+
+func (r *IPCRequest) String(name string) string {
+	return r.Args[name]
+}
+
+func (r *IPCRequest) Int(name string) int {
+	n, _ := strconv.Atoi(r.Args[name])
+	return n
+}
+
+func (r *IPCRequest) Bool(name string) bool {
+	b, _ := strconv.ParseBool(r.Args[name])
+	return b
+}
+
+func (r *IPCRequest) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(r.Args[name])
+	return d
+}
+
+// Cred 返回调用方凭证,无法获取时为 nil
+func (r *IPCRequest) Cred() *IPCCred {
+	return r.cred
+}
+
+// Decode 解析响应数据
+func (r *IPCResponse) Decode(v any) error {
+	if len(r.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Data, v)
+}
+
+// Err 响应码不为 IPC_OK 时返回 *IPCError
+func (r *IPCResponse) Err() error {
+	if r.Code == IPC_OK {
+		return nil
+	}
+	return NewIPCError(r.Code, r.Msg)
+}
+
+// Text 以文本形式返回响应内容
+func (r *IPCResponse) Text() string {
+	var s string
+	if err := json.Unmarshal(r.Data, &s); err == nil {
+		return s
+	}
+	if len(r.Data) > 0 {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, r.Data, "", "  "); err == nil {
+			return buf.String()
+		}
+		return string(r.Data)
+	}
+	return r.Msg
+}
+
+// checkArgs 校验参数类型,并补全默认值
+func (h *IPCHandler) checkArgs(args map[string]string) (map[string]string, error) {
+	ret := make(map[string]string, len(h.Args))
+	for _, a := range h.Args {
+		v, ok := args[a.Name]
+		if !ok {
+			v = a.Default
+		}
+		if v != "" {
+			var err error
+			switch a.Type {
+			case ARG_INT:
+				_, err = strconv.Atoi(v)
+			case ARG_BOOL:
+				_, err = strconv.ParseBool(v)
+			case ARG_DURATION:
+				_, err = time.ParseDuration(v)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s argument %s=%q", a.Type, a.Name, v)
+			}
+		}
+		ret[a.Name] = v
+	}
+	for k := range args {
+		if _, ok := ret[k]; !ok {
+			return nil, fmt.Errorf("unknown argument %s", k)
+		}
+	}
+	return ret, nil
+}
+
+// noCredIPC 无法获取对端凭证的平台上允许调用的只读命令
+var noCredIPC = map[string]bool{"stats": true, "config": true, "supervisor": true}
+
+// allow 判断调用方是否有权限执行命令
+// 支持获取对端凭证的平台获取失败时拒绝,不支持的平台只允许未声明 Uids/Gids 的只读命令
+func (h *IPCHandler) allow(name string, cred *IPCCred) bool {
+	if cred == nil {
+		return !peerCredSupported && noCredIPC[name] && len(h.Uids) == 0 && len(h.Gids) == 0
+	}
+	if cred.Uid == 0 {
+		return true
+	}
+	if len(h.Uids) == 0 && len(h.Gids) == 0 {
+		return cred.Uid == os.Geteuid() || (defOpt.ipcUid >= 0 && cred.Uid == defOpt.ipcUid)
+	}
+	for _, uid := range h.Uids {
+		if uid == cred.Uid {
+			return true
+		}
+	}
+	for _, gid := range h.Gids {
+		if gid == cred.Gid {
+			return true
+		}
+		for _, g := range cred.Groups {
+			if gid == g {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleIPC 执行请求并生成响应,处理器返回 IPCStream 时同时返回数据流
+func handleIPC(req *IPCRequest) (resp *IPCResponse, stream IPCStream) {
+	resp = &IPCResponse{Id: req.Id}
+	h := getIPC(req.Cmd)
+	if h == nil {
+		resp.Code, resp.Msg = IPC_NOT_FOUND, "unknown command "+req.Cmd
+		return
+	}
+	if !h.allow(req.Cmd, req.cred) {
+		if req.cred == nil {
+			logger.Warnw("ipc permission denied, peer credentials unavailable", "cmd", req.Cmd)
+		} else {
+			logger.Warnw("ipc permission denied", "cmd", req.Cmd, "pid", req.cred.Pid, "uid", req.cred.Uid, "gid", req.cred.Gid)
+		}
+		resp.Code, resp.Msg = IPC_FORBIDDEN, "permission denied"
+		return
+	}
+	args, err := h.checkArgs(req.Args)
+	if err != nil {
+		resp.Code, resp.Msg = IPC_BAD_REQUEST, err.Error()
+		return
+	}
+	req.Args = args
+	defer OnPanic(func(a any, s string) {
+		resp.Code, resp.Msg, resp.Data, stream = IPC_INTERNAL, fmt.Sprint("panic: ", a), nil, nil
+	})
+	data, err := h.Handle(req)
+	if err != nil {
+		var ie *IPCError
+		if errors.As(err, &ie) {
+			resp.Code, resp.Msg = ie.Code, ie.Msg
+		} else {
+			resp.Code, resp.Msg = IPC_INTERNAL, err.Error()
+		}
+		return
+	}
+	if s, ok := data.(IPCStream); ok && s != nil {
+		resp.Stream = true
+		return resp, s
+	}
+	if data != nil {
+		if resp.Data, err = json.Marshal(data); err != nil {
+			resp.Code, resp.Msg = IPC_INTERNAL, err.Error()
+		}
+	}
+	return
+}
+
+// writeFrame 写入一帧: 4 字节大端长度 + 数据
+func writeFrame(w io.Writer, data []byte) error {
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readFrame 读取一帧
+func readFrame(r io.Reader) ([]byte, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(head[:])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("ipc frame too large: %d", n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// frameWriter 将每次写入的数据作为一帧发送
+type frameWriter struct {
+	w io.Writer
+}
+
+func (f *frameWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := writeFrame(f.w, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeStream 以数据帧发送流式响应,以空帧结束,stream panic 时同样发送空帧
+func writeStream(w io.Writer, stream IPCStream) error {
+	bw := bufio.NewWriterSize(&frameWriter{w: w}, 32*1024)
+	err := runStream(bw, stream)
+	if errFlush := bw.Flush(); err == nil {
+		err = errFlush
+	}
+	if errEnd := writeFrame(w, nil); err == nil {
+		err = errEnd
+	}
+	return err
+}
+
+// runStream 执行 stream,panic 时返回错误
+func runStream(w io.Writer, stream IPCStream) (err error) {
+	defer OnPanic(func(a any, s string) {
+		err = fmt.Errorf("panic: %v", a)
+	})
+	return stream(w)
+}
+
+func writeJSONFrame(w io.Writer, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, buf)
+}
+
+func readJSONFrame(r io.Reader, v any) error {
+	buf, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "ctl <cmd>",
+	Long:  `send ipc command to running service`,
+}
+
+// addIPCCmds 为已注册的 IPC 命令生成 ctl 子命令
+func addIPCCmds() {
+	ipcMu.RLock()
+	names := make([]string, 0, len(ipcHandlers))
+	for name := range ipcHandlers {
+		names = append(names, name)
+	}
+	ipcMu.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		ctlCmd.AddCommand(newIPCCmd(name, getIPC(name)))
+	}
+}
+
+func newIPCCmd(name string, h *IPCHandler) *cobra.Command {
+	c := &cobra.Command{
+		Use:   name,
+		Short: h.Short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params := map[string]string{}
+			for _, a := range h.Args {
+				if f := cmd.Flags().Lookup(a.Name); f != nil && f.Changed {
+					params[a.Name] = f.Value.String()
+				}
+			}
+			resp, err := CallIPCStream(name, params, os.Stdout, defOpt.ipcTimeout)
+			if err != nil {
+				return err
+			}
+			if err = resp.Err(); err != nil {
+				return err
+			}
+			if text := resp.Text(); text != "" {
+				fmt.Println(text)
+			}
+			return nil
+		},
+	}
+	c.SilenceUsage = true
+	for _, a := range h.Args {
+		switch a.Type {
+		case ARG_INT:
+			n, _ := strconv.Atoi(a.Default)
+			c.Flags().Int(a.Name, n, a.Usage)
+		case ARG_BOOL:
+			b, _ := strconv.ParseBool(a.Default)
+			c.Flags().Bool(a.Name, b, a.Usage)
+		case ARG_DURATION:
+			d, _ := time.ParseDuration(a.Default)
+			c.Flags().Duration(a.Name, d, a.Usage)
+		default:
+			c.Flags().String(a.Name, a.Default, a.Usage)
+		}
+	}
+	return c
+}
+
+func init() {
+	RootCmd.AddCommand(ctlCmd)
+}
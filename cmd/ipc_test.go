@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerTestIPC 注册测试命令,测试结束后删除
+func registerTestIPC(t *testing.T, name string, h IPCHandler) {
+	RegisterIPC(name, h)
+	t.Cleanup(func() {
+		ipcMu.Lock()
+		delete(ipcHandlers, name)
+		ipcMu.Unlock()
+	})
+}
+
+// frame 生成长度头为 n,数据为 data 的帧
+func frame(n uint32, data string) []byte {
+	buf := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(buf, n)
+	return append(buf, data...)
+}
+
+func TestReadFrame(t *testing.T) {
+	cases := []struct {
+		name  string
+		input []byte
+		want  string
+		err   string
+	}{
+		{"ok", frame(5, "hello"), "hello", ""},
+		{"empty", frame(0, ""), "", ""},
+		{"eof", nil, "", "EOF"},
+		{"short head", []byte{0, 0}, "", "unexpected EOF"},
+		{"short body", frame(5, "he"), "", "unexpected EOF"},
+		{"too large", frame(maxFrameSize+1, "x"), "", "ipc frame too large"},
+	}
+	for _, c := range cases {
+		buf, err := readFrame(bytes.NewReader(c.input))
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatal(c.name, err)
+			}
+			continue
+		}
+		if err != nil || string(buf) != c.want {
+			t.Fatal(c.name, string(buf), err)
+		}
+	}
+}
+
+func TestCheckArgs(t *testing.T) {
+	h := &IPCHandler{Args: []IPCArg{
+		{Name: "name", Type: ARG_STRING},
+		{Name: "n", Type: ARG_INT, Default: "10"},
+		{Name: "all", Type: ARG_BOOL},
+		{Name: "wait", Type: ARG_DURATION, Default: "1s"},
+	}}
+	cases := []struct {
+		args map[string]string
+		want map[string]string
+		err  string
+	}{
+		{nil, map[string]string{"name": "", "n": "10", "all": "", "wait": "1s"}, ""},
+		{map[string]string{"name": "a", "n": "3", "all": "true", "wait": "2m"}, map[string]string{"name": "a", "n": "3", "all": "true", "wait": "2m"}, ""},
+		{map[string]string{"n": ""}, map[string]string{"name": "", "n": "", "all": "", "wait": "1s"}, ""},
+		{map[string]string{"n": "x"}, nil, `invalid int argument n="x"`},
+		{map[string]string{"all": "yes"}, nil, `invalid bool argument all="yes"`},
+		{map[string]string{"wait": "10"}, nil, `invalid duration argument wait="10"`},
+		{map[string]string{"other": "1"}, nil, "unknown argument other"},
+	}
+	for i, c := range cases {
+		got, err := h.checkArgs(c.args)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatal(i, err)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(c.want) {
+			t.Fatal(i, got, err)
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Fatal(i, k, got[k])
+			}
+		}
+	}
+}
+
+func TestHandleIPC(t *testing.T) {
+	registerTestIPC(t, "test_echo", IPCHandler{
+		Args: []IPCArg{{Name: "n", Type: ARG_INT, Default: "1"}},
+		Handle: func(req *IPCRequest) (any, error) {
+			return req.Int("n") * 2, nil
+		},
+	})
+	registerTestIPC(t, "test_err", IPCHandler{Handle: func(req *IPCRequest) (any, error) {
+		return nil, errors.New("failed")
+	}})
+	registerTestIPC(t, "test_ipc_err", IPCHandler{Handle: func(req *IPCRequest) (any, error) {
+		return nil, NewIPCError(IPC_NOT_FOUND, "no such item")
+	}})
+	registerTestIPC(t, "test_panic", IPCHandler{Handle: func(req *IPCRequest) (any, error) {
+		panic("boom")
+	}})
+	registerTestIPC(t, "test_marshal", IPCHandler{Handle: func(req *IPCRequest) (any, error) {
+		return func() {}, nil
+	}})
+	registerTestIPC(t, "test_uid", IPCHandler{Uids: []int{4242}, Gids: []int{100}, Handle: func(req *IPCRequest) (any, error) {
+		return "ok", nil
+	}})
+
+	self := &IPCCred{Pid: 1, Uid: os.Geteuid(), Gid: os.Getegid()}
+	user := &IPCCred{Pid: 1, Uid: 4242, Gid: 4242}
+	other := &IPCCred{Pid: 1, Uid: 4343, Gid: 4343}
+	cases := []struct {
+		name string
+		cmd  string
+		args map[string]string
+		cred *IPCCred
+		code int
+		msg  string
+		data string
+	}{
+		{"ok", "test_echo", map[string]string{"n": "21"}, self, IPC_OK, "", "42"},
+		{"default arg", "test_echo", nil, self, IPC_OK, "", "2"},
+		{"not found", "test_missing", nil, self, IPC_NOT_FOUND, "unknown command test_missing", ""},
+		{"bad arg", "test_echo", map[string]string{"n": "x"}, self, IPC_BAD_REQUEST, `invalid int argument n="x"`, ""},
+		{"unknown arg", "test_echo", map[string]string{"m": "1"}, self, IPC_BAD_REQUEST, "unknown argument m", ""},
+		{"error", "test_err", nil, self, IPC_INTERNAL, "failed", ""},
+		{"ipc error", "test_ipc_err", nil, self, IPC_NOT_FOUND, "no such item", ""},
+		{"panic", "test_panic", nil, self, IPC_INTERNAL, "panic: boom", ""},
+		{"marshal", "test_marshal", nil, self, IPC_INTERNAL, "json: unsupported type: func()", ""},
+		{"default forbidden", "test_echo", nil, other, IPC_FORBIDDEN, "permission denied", ""},
+		{"uid allowed", "test_uid", nil, user, IPC_OK, "", `"ok"`},
+		{"uid forbidden", "test_uid", nil, other, IPC_FORBIDDEN, "permission denied", ""},
+		{"group allowed", "test_uid", nil, &IPCCred{Uid: 4343, Gid: 4343, Groups: []int{100}}, IPC_OK, "", `"ok"`},
+		{"root", "test_uid", nil, &IPCCred{Uid: 0}, IPC_OK, "", `"ok"`},
+	}
+	for _, c := range cases {
+		resp, stream := handleIPC(&IPCRequest{Id: "1", Cmd: c.cmd, Args: c.args, cred: c.cred})
+		if stream != nil || resp.Id != "1" || resp.Code != c.code || resp.Msg != c.msg || string(resp.Data) != c.data {
+			t.Fatalf("%s: %+v %s", c.name, resp, resp.Data)
+		}
+	}
+
+	// 没有对端凭证时只允许不支持凭证的平台调用只读命令
+	if resp, _ := handleIPC(&IPCRequest{Cmd: "test_echo"}); resp.Code != IPC_FORBIDDEN {
+		t.Fatal("nil cred", resp.Code)
+	}
+	h := &IPCHandler{}
+	if h.allow("stats", nil) == peerCredSupported {
+		t.Fatal("nil cred stats")
+	}
+	h.Uids = []int{4242}
+	if h.allow("stats", nil) {
+		t.Fatal("nil cred with uids")
+	}
+}
+
+// readStream 读取数据帧直到空帧
+func readStream(t *testing.T, r io.Reader) []string {
+	var frames []string
+	for {
+		buf, err := readFrame(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) == 0 {
+			return frames
+		}
+		frames = append(frames, string(buf))
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	cases := []struct {
+		name   string
+		stream IPCStream
+		frames []string
+		err    string
+	}{
+		{"data", func(w io.Writer) error {
+			io.WriteString(w, "hello ")
+			io.WriteString(w, "world")
+			return nil
+		}, []string{"hello world"}, ""},
+		{"empty", func(w io.Writer) error { return nil }, nil, ""},
+		{"large", func(w io.Writer) error {
+			_, err := w.Write(bytes.Repeat([]byte("x"), 40*1024))
+			return err
+		}, []string{strings.Repeat("x", 40*1024)}, ""},
+		{"error", func(w io.Writer) error {
+			io.WriteString(w, "partial")
+			return errors.New("stream failed")
+		}, []string{"partial"}, "stream failed"},
+		{"panic", func(w io.Writer) error { panic("boom") }, nil, "panic: boom"},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		err := writeStream(&buf, c.stream)
+		if (c.err == "" && err != nil) || (c.err != "" && (err == nil || err.Error() != c.err)) {
+			t.Fatal(c.name, err)
+		}
+		frames := readStream(t, &buf)
+		if strings.Join(frames, "") != strings.Join(c.frames, "") {
+			t.Fatalf("%s: %q", c.name, frames)
+		}
+		// 空帧之后没有多余数据
+		if buf.Len() != 0 {
+			t.Fatal(c.name, "trailing bytes", buf.Len())
+		}
+	}
+}
+
+func TestNewIPCCmd(t *testing.T) {
+	c := newIPCCmd("test", &IPCHandler{
+		Short: "test command",
+		Args: []IPCArg{
+			{Name: "name", Type: ARG_STRING, Default: "a", Usage: "name"},
+			{Name: "n", Type: ARG_INT, Default: "10"},
+			{Name: "all", Type: ARG_BOOL, Default: "true"},
+			{Name: "wait", Type: ARG_DURATION, Default: "1m"},
+			{Name: "bad", Type: ARG_INT, Default: "x"},
+		},
+	})
+	if c.Use != "test" || c.Short != "test command" {
+		t.Fatal(c.Use, c.Short)
+	}
+	want := map[string][2]string{
+		"name": {"string", "a"},
+		"n":    {"int", "10"},
+		"all":  {"bool", "true"},
+		"wait": {"duration", "1m0s"},
+		"bad":  {"int", "0"},
+	}
+	for name, w := range want {
+		f := c.Flags().Lookup(name)
+		if f == nil || f.Value.Type() != w[0] || f.DefValue != w[1] {
+			t.Fatal(name, f)
+		}
+	}
+	if err := c.Flags().Parse([]string{"--n", "x"}); err == nil {
+		t.Fatal("expect invalid int flag")
+	}
+}
+
+func TestIPCRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.ipc")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveIPC(conn)
+		}
+	}()
+	old := defOpt.ipcPath
+	defOpt.ipcPath = path
+	defer func() { defOpt.ipcPath = old }()
+
+	registerTestIPC(t, "test_echo", IPCHandler{
+		Args: []IPCArg{{Name: "text", Type: ARG_STRING}},
+		Handle: func(req *IPCRequest) (any, error) {
+			if req.Cred() == nil {
+				return nil, errors.New("no cred")
+			}
+			return req.String("text"), nil
+		},
+	})
+	registerTestIPC(t, "test_stream", IPCHandler{
+		Args: []IPCArg{{Name: "fail", Type: ARG_BOOL}},
+		Handle: func(req *IPCRequest) (any, error) {
+			return IPCStream(func(w io.Writer) error {
+				io.WriteString(w, "line 1\nline 2\n")
+				if req.Bool("fail") {
+					return errors.New("stream failed")
+				}
+				return nil
+			}), nil
+		},
+	})
+
+	resp, err := CallIPC("test_echo", map[string]string{"text": "hello"})
+	if err != nil || resp.Err() != nil || resp.Text() != "hello" {
+		t.Fatal(resp, err)
+	}
+	if resp, err = CallIPC("test_missing", nil); err != nil || resp.Code != IPC_NOT_FOUND {
+		t.Fatal(resp, err)
+	}
+
+	var out bytes.Buffer
+	resp, err = CallIPCStream("test_stream", nil, &out, time.Second)
+	if err != nil || resp.Err() != nil || out.String() != "line 1\nline 2\n" {
+		t.Fatal(resp, err, out.String())
+	}
+	// 数据流出错时通过最后的响应帧返回
+	out.Reset()
+	resp, err = CallIPCStream("test_stream", map[string]string{"fail": "true"}, &out, time.Second)
+	if err != nil || resp.Code != IPC_INTERNAL || resp.Msg != "stream failed" || out.String() != "line 1\nline 2\n" {
+		t.Fatal(resp, err, out.String())
+	}
+
+	// 同一连接上连续发送多个请求
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for _, id := range []string{"a", "b"} {
+		if err = writeJSONFrame(conn, &IPCRequest{Id: id, Cmd: "test_echo", Args: map[string]string{"text": id}}); err != nil {
+			t.Fatal(err)
+		}
+		var r IPCResponse
+		if err = readJSONFrame(reader, &r); err != nil || r.Id != id || r.Text() != id {
+			t.Fatal(r, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// errLocked 锁已被其他进程持有
+var errLocked = errors.New("file already locked")
+
+// lockInfo pid 文件内容
+type lockInfo struct {
+	Pid     int
+	Start   time.Time
+	Version string
+}
+
+var lockFile *os.File
+
+// runningPid 探测时会短暂持有共享锁,加排他锁失败后在该时间内重试
+const (
+	lockRetryTimeout  = 500 * time.Millisecond
+	lockRetryInterval = 20 * time.Millisecond
+)
+
+func (info *lockInfo) String() string {
+	return fmt.Sprintf("pid %d started at %s, version %s", info.Pid, info.Start.Format("2006-01-02 15:04:05"), info.Version)
+}
+
+// readLockInfo 读取 pid 文件: 每行依次为 pid,启动时间,版本
+func readLockInfo() (*lockInfo, error) {
+	f, err := os.Open(pidPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if len(lines) == 0 || tools.AtoI(lines[0]) <= 0 {
+		return nil, fmt.Errorf("invalid pid file %s", pidPath())
+	}
+	info := &lockInfo{Pid: tools.AtoI(lines[0])}
+	if len(lines) > 1 {
+		info.Start, _ = time.Parse(time.RFC3339, lines[1])
+	}
+	if len(lines) > 2 {
+		info.Version = lines[2]
+	}
+	return info, nil
+}
+
+// acquireLock 对 pid 文件加排他锁,保证只有一个实例运行
+// 锁随进程退出自动释放,因此残留的 pid 文件不会影响下次启动
+func acquireLock() error {
+	path := pidPath()
+	f, ok := inheritFile(listenKey("lock", path))
+	if !ok {
+		var err error
+		if f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644); err != nil {
+			return fmt.Errorf("open lock file: %w", err)
+		}
+		if err = lockRetry(f); err != nil {
+			f.Close()
+			if !errors.Is(err, errLocked) {
+				return fmt.Errorf("lock %s: %w", path, err)
+			}
+			if info, e := readLockInfo(); e == nil {
+				return fmt.Errorf("already running, %s (lock %s)", info, path)
+			}
+			return fmt.Errorf("already running (lock %s)", path)
+		}
+	}
+	if err := writeLockInfo(f); err != nil {
+		f.Close()
+		return err
+	}
+	lockFile = f
+	addHandoverFile(listenKey("lock", path), f)
+	return nil
+}
+
+// lockRetry 加排他锁,锁被占用时短暂重试
+func lockRetry(f *os.File) error {
+	deadline := time.Now().Add(lockRetryTimeout)
+	for {
+		err := lockFileNB(f, true)
+		if !errors.Is(err, errLocked) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// writeLockInfo 将当前进程信息写入 pid 文件
+func writeLockInfo(f *os.File) error {
+	content := fmt.Sprintf("%d\n%s\n%s\n", os.Getpid(), startTime.Format(time.RFC3339), Version)
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(content), 0)
+	return err
+}
+
+// restoreLockInfo 平滑升级失败时恢复 pid 文件,子进程可能已写入自己的 pid
+func restoreLockInfo() {
+	if lockFile == nil {
+		return
+	}
+	if err := writeLockInfo(lockFile); err != nil {
+		logger.Warnln("restore pid file", err)
+	}
+}
+
+// releaseLock 清空并释放 pid 文件锁,平滑升级后锁由新进程持有
+func releaseLock() {
+	if lockFile == nil {
+		return
+	}
+	if atomic.LoadInt32(&handedOver) == 0 {
+		lockFile.Truncate(0)
+		unlockFile(lockFile)
+	}
+	lockFile.Close()
+	lockFile = nil
+}
+
+// runningPid 返回持有锁的进程 pid
+func runningPid() (int, bool) {
+	f, err := os.Open(pidPath())
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	if err = lockFileNB(f, false); err == nil {
+		unlockFile(f)
+		return 0, false
+	}
+	info, err := readLockInfo()
+	if err != nil {
+		return 0, true
+	}
+	return info.Pid, true
+}
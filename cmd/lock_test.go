@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLockRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.pid")
+	probe, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.Close()
+	// 模拟 runningPid 持有共享锁
+	if err = lockFileNB(probe, false); err != nil {
+		t.Fatal(err)
+	}
+	unlocked := make(chan struct{})
+	time.AfterFunc(lockRetryTimeout/5, func() {
+		unlockFile(probe)
+		close(unlocked)
+	})
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = lockRetry(f); err != nil {
+		t.Fatal(err)
+	}
+	<-unlocked
+
+	// 排他锁一直被持有时超时失败
+	other, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	start := time.Now()
+	if err = lockRetry(other); err != errLocked {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost < lockRetryTimeout {
+		t.Fatal("retry cost", cost)
+	}
+}
+
+func TestRestoreLockInfo(t *testing.T) {
+	f, err := os.OpenFile(filepath.Join(t.TempDir(), "app.pid"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// 升级失败的子进程写入的 pid
+	f.WriteAt([]byte("999999999\n"), 0)
+	lockFile = f
+	defer func() { lockFile = nil }()
+	restoreLockInfo()
+	data := readFile(t, f.Name())
+	if want := strconv.Itoa(os.Getpid()) + "\n"; len(data) < len(want) || data[:len(want)] != want {
+		t.Fatalf("got %q", data)
+	}
+}
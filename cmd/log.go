@@ -1,48 +1,79 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/spf13/cobra"
+	"github.com/ulikunitz/xz"
 	"github.com/zhiyin2021/zycli/tools"
 	"github.com/zhiyin2021/zycli/tools/logger"
 )
 
+// 日志查看参数
+var logFlags = struct {
+	lines    int
+	catLines int
+	follow   bool
+	rotated  bool
+	page     bool
+	pageSize int
+}{}
+
 var logCmd = &cobra.Command{
-	Use:   "log",
+	Use:   "log [day|file]",
 	Short: "log cat,log ls, log [cmd] yyyyMMdd",
-	Long:  `log3 service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		if logPath, err := getLogPath(args); err == nil {
-			cc := exec.Command("tail", "-f", logPath)
-			cc.Stdout = os.Stdout
-			//异步启动子进程
-			cc.Run()
+	Long: `show last lines of log and follow new lines, like tail -F
+  day: yyyyMMdd, yyyy-MM-dd, today, yesterday, -Nd (N days ago, use "--" before it), or range <day>..<day>`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := logFiles(args)
+		if err != nil {
+			return err
+		}
+		w, flush := prettyOutput(os.Stdout, os.Stdout)
+		defer flush()
+		if len(files) == 1 && logCompressExt(files[0]) == "" {
+			return tailFile(w, files[0], logFlags.lines, logFlags.follow, logFlags.rotated)
 		}
+		return tailLines(w, files, logFlags.lines)
 	},
 }
 
 var catLogCmd = &cobra.Command{
-	Use:   "cat",
+	Use:   "cat [day|file...]",
 	Short: "cat",
-	Long:  `cat log `,
-	Run: func(cmd *cobra.Command, args []string) {
-		if logPath, _ := getLogPath(args); logPath != "" {
-			if !tools.FileExists(logPath) {
-				cc := exec.Command("zcat", logPath+".gz")
-				cc.Stdout = os.Stdout
-				//异步启动子进程
-				cc.Run()
-			} else {
-				cc := exec.Command("cat", logPath)
-				cc.Stdout = os.Stdout
-				//异步启动子进程
-				cc.Run()
-			}
+	Long: `cat log, compressed files are decompressed
+  day: yyyyMMdd, yyyy-MM-dd, today, yesterday, -Nd (N days ago, use "--" before it), or range <day>..<day>`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := logFiles(args)
+		if err != nil {
+			return err
 		}
+		var w io.Writer = os.Stdout
+		if logFlags.page {
+			w = newPager(os.Stdout, os.Stdin, logFlags.pageSize)
+		}
+		w, flush := prettyOutput(w, os.Stdout)
+		defer flush()
+		if logFlags.catLines > 0 {
+			err = tailLines(w, files, logFlags.catLines)
+		} else {
+			err = catFiles(w, files)
+		}
+		if errors.Is(err, errPagerQuit) {
+			return nil
+		}
+		return err
 	},
 }
 
@@ -50,33 +81,454 @@ var lsLogCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "ls",
 	Long:  `ls log `,
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		fmt.Println("log path:", defOpt.logPath)
-		cc := exec.Command("ls", "-lah", defOpt.logPath)
-		cc.Stdout = os.Stdout
-		cc.Stdin = os.Stdin
-		//异步启动子进程
-		cc.Run()
+		list, err := os.ReadDir(defOpt.logPath)
+		if err != nil {
+			return err
+		}
+		for _, e := range list {
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			size := fmtBytes(uint64(info.Size()))
+			if info.IsDir() {
+				size = "-"
+			}
+			fmt.Printf("%s %8s  %s\n", info.ModTime().Format("2006-01-02 15:04:05"), size, info.Name())
+		}
+		return nil
 	},
 }
 
-func getLogPath(args []string) (string, error) {
-	logName := defOpt.logPath + tools.CurrentName() + ".log"
-	if len(args) > 0 {
-		if len(args[0]) == 8 {
-			logName += "." + args[0]
-		} else {
-			fmt.Println("View Historical Log Format yyyyMMdd")
-			return logName, errors.New("view Historical Log Format yyyyMMdd")
+// activeLogPath 当前日志文件路径
+func activeLogPath() string {
+	return defOpt.logPath + tools.CurrentName() + ".log"
+}
+
+// logCompressExt 返回压缩扩展名,未压缩返回空
+func logCompressExt(path string) string {
+	return path[len(trimCompressExt(path)):]
+}
+
+// openLog 打开日志文件,按扩展名透明解压 .gz/.xz/.zst
+func openLog(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	switch logCompressExt(path) {
+	case string(CT_GZ):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &logReader{Reader: gz, closers: []io.Closer{gz, f}}, nil
+	case string(CT_XZ):
+		r, err := xz.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &logReader{Reader: r, closers: []io.Closer{f}}, nil
+	case string(CT_ZST):
+		d, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r := d.IOReadCloser()
+		return &logReader{Reader: r, closers: []io.Closer{r, f}}, nil
+	}
+	return f, nil
+}
+
+// logReader 解压后的日志内容
+type logReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *logReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// parseDay 解析日期: yyyyMMdd, yyyy-MM-dd, today, yesterday, -Nd(N 天前)
+func parseDay(s string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch s {
+	case "today":
+		return today, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+	if len(s) > 2 && s[0] == '-' && s[len(s)-1] == 'd' {
+		if n, err := strconv.Atoi(s[1 : len(s)-1]); err == nil && n >= 0 {
+			return today.AddDate(0, 0, -n), true
+		}
+		return time.Time{}, false
+	}
+	for _, layout := range []string{"20060102", "2006-01-02"} {
+		if len(s) != len(layout) {
+			continue
+		}
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDayRange 解析日期或日期范围 <day>..<day>
+func parseDayRange(s string, now time.Time) (from, to time.Time, ok bool) {
+	a, b, isRange := strings.Cut(s, "..")
+	if from, ok = parseDay(a, now); !ok {
+		return
+	}
+	if !isRange {
+		return from, from, true
+	}
+	if to, ok = parseDay(b, now); !ok {
+		return
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	return from, to, true
+}
+
+// historyFiles 返回日期范围内当前日志和切割的日志文件,按时间顺序
+func historyFiles(from, to time.Time) ([]string, error) {
+	parts, err := logParts()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, p := range parts {
+		if !p.day.Before(from) && !p.day.After(to) {
+			files = append(files, p.path)
+		}
+	}
+	return files, nil
+}
+
+// logFiles 解析命令参数: 无参数为当前日志, 日期或日期范围为当天所有切割的日志,其他为日志目录下的文件名或路径
+func logFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{activeLogPath()}
+	}
+	now := time.Now()
+	var files []string
+	for _, arg := range args {
+		if from, to, ok := parseDayRange(arg, now); ok {
+			list, err := historyFiles(from, to)
+			if err != nil {
+				return nil, err
+			}
+			if len(list) == 0 {
+				return nil, fmt.Errorf("no log file of %s in %s", arg, defOpt.logPath)
+			}
+			files = append(files, list...)
+			continue
+		}
+		path := arg
+		if !tools.FileExists(path) {
+			path = filepath.Join(defOpt.logPath, arg)
+		}
+		if !tools.FileExists(path) {
+			return nil, fmt.Errorf("log file not exists %s", arg)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// catFiles 依次输出日志内容
+func catFiles(w io.Writer, files []string) error {
+	for _, path := range files {
+		r, err := openLog(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tailLines 输出多个文件合并后的最后 n 行,用于压缩文件
+func tailLines(w io.Writer, files []string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	ring := make([]string, n)
+	count := 0
+	for _, path := range files {
+		r, err := openLog(path)
+		if err != nil {
+			return err
+		}
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if line != "" {
+				ring[count%n] = line
+				count++
+			}
+			if err != nil {
+				r.Close()
+				if err != io.EOF {
+					return err
+				}
+				break
+			}
 		}
 	}
-	if !tools.FileExists(logName) {
-		fmt.Println("log file not exist", logName)
-		return logName, errors.New("log file not exists " + logName)
+	start := 0
+	if count > n {
+		start = count - n
+	}
+	for i := start; i < count; i++ {
+		if _, err := io.WriteString(w, ring[i%n]); err != nil {
+			return err
+		}
 	}
-	return logName, nil
+	return nil
 }
 
+// tailOffset 从文件末尾向前查找最后 n 行的起始位置
+func tailOffset(f *os.File, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+	buf := make([]byte, 32*1024)
+	pos, count := size, 0
+	for pos > 0 {
+		m := int64(len(buf))
+		if pos < m {
+			m = pos
+		}
+		pos -= m
+		if _, err := f.ReadAt(buf[:m], pos); err != nil {
+			return 0, err
+		}
+		for i := m - 1; i >= 0; i-- {
+			// 末尾的换行不计入
+			if buf[i] != '\n' || pos+i == size-1 {
+				continue
+			}
+			if count++; count == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// 跟踪日志时的轮询间隔
+const followInterval = 200 * time.Millisecond
+
+// countLines 统计行数,最后一行没有换行也计入
+func countLines(r io.Reader) (int, error) {
+	buf := make([]byte, 32*1024)
+	count, last := 0, byte('\n')
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			count += bytes.Count(buf[:n], []byte{'\n'})
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		count++
+	}
+	return count, nil
+}
+
+// replayRotated 从最近的切割文件中输出最后 n 行
+func replayRotated(w io.Writer, n int) error {
+	parts, err := logParts()
+	if err != nil {
+		return err
+	}
+	var files []string
+	total := 0
+	for i := len(parts) - 1; i >= 0 && total < n; i-- {
+		if parts[i].n == 0 {
+			continue
+		}
+		r, err := openLog(parts[i].path)
+		if err != nil {
+			return err
+		}
+		c, err := countLines(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		files = append([]string{parts[i].path}, files...)
+		total += c
+	}
+	return tailLines(w, files, n)
+}
+
+// tailFile 输出最后 n 行,follow 时持续输出新写入的内容
+// rotated 时当前日志不足 n 行则从切割文件中补足
+func tailFile(w io.Writer, path string, n int, follow, rotated bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		err = func() error {
+			off, err := tailOffset(f, info.Size(), n)
+			if err != nil {
+				return err
+			}
+			if off == 0 && rotated && path == activeLogPath() {
+				c, err := countLines(io.NewSectionReader(f, 0, info.Size()))
+				if err != nil {
+					return err
+				}
+				if c < n {
+					if err = replayRotated(w, n-c); err != nil {
+						return err
+					}
+				}
+			}
+			_, err = io.Copy(w, io.NewSectionReader(f, off, info.Size()-off))
+			return err
+		}()
+	}
+	if err != nil || !follow {
+		f.Close()
+		return err
+	}
+	return followFile(w, path, f, info.Size())
+}
+
+// followFile 从 off 开始持续输出新写入的内容,类似 tail -F
+// 文件被截断时从头读取,被切割改名后读完旧文件再打开同名的新文件
+func followFile(w io.Writer, path string, f *os.File, off int64) error {
+	defer func() {
+		f.Close()
+	}()
+	drain := func() (os.FileInfo, error) {
+		for {
+			info, err := f.Stat()
+			if err != nil {
+				return nil, err
+			}
+			if info.Size() < off {
+				off = 0
+			}
+			if info.Size() == off {
+				return info, nil
+			}
+			n, err := io.Copy(w, io.NewSectionReader(f, off, info.Size()-off))
+			off += n
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	for {
+		info, err := drain()
+		if err != nil {
+			return err
+		}
+		cur, err := os.Stat(path)
+		if err != nil || os.SameFile(info, cur) {
+			// 文件不存在时等待重新创建
+			time.Sleep(followInterval)
+			continue
+		}
+		nf, err := os.Open(path)
+		if err != nil {
+			time.Sleep(followInterval)
+			continue
+		}
+		// 切换前再读一次,避免漏掉改名前写入的内容
+		if _, err = drain(); err != nil {
+			nf.Close()
+			return err
+		}
+		f.Close()
+		f, off = nf, 0
+	}
+}
+
+// errPagerQuit 分页时用户退出
+var errPagerQuit = errors.New("pager quit")
+
+// pager 每输出一屏等待回车继续,输入 q 退出
+type pager struct {
+	w     io.Writer
+	in    *bufio.Reader
+	size  int
+	lines int
+}
+
+func newPager(w *os.File, in io.Reader, size int) *pager {
+	if size <= 0 {
+		// 保留一行显示提示
+		if size = termRows(w) - 1; size <= 0 {
+			size = 40
+		}
+	}
+	return &pager{w: w, in: bufio.NewReader(in), size: size}
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		i := strings.IndexByte(string(b), '\n')
+		chunk := b
+		if i >= 0 {
+			chunk = b[:i+1]
+		}
+		n, err := p.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+		if i < 0 {
+			break
+		}
+		if p.lines++; p.lines >= p.size {
+			p.lines = 0
+			fmt.Fprint(os.Stderr, "-- more -- (enter: next page, q: quit)")
+			line, err := p.in.ReadString('\n')
+			if err != nil || strings.TrimSpace(line) == "q" {
+				return written, errPagerQuit
+			}
+		}
+	}
+	return written, nil
+}
+
+// activeLog 当前使用的日志文件,重载时切割
+var activeLog *logWriter
+
 func (opt *cmdOpt) initLog() {
 	logPath := opt.logPath + tools.CurrentName()
 
@@ -84,11 +536,25 @@ func (opt *cmdOpt) initLog() {
 		l.maxAge = opt.maxAge
 		l.maxCount = opt.maxCount
 		l.compressType = opt.compressType
+		l.rotation = opt.rotation
+		l.errorHandler = func(err error) {
+			logger.Errorw("log compress or cleanup failed", "err", err)
+		}
 	}, OptMaxSize(opt.maxSize))
 
+	activeLog = logWrite
 	logger.SetLogger(logWrite)
 }
 func init() {
+	logCmd.Flags().IntVarP(&logFlags.lines, "lines", "n", 10, "output the last N lines")
+	logCmd.Flags().BoolVarP(&logFlags.follow, "follow", "f", true, "output appended data as the file grows, reopen the file after rotation")
+	logCmd.Flags().BoolVar(&logFlags.rotated, "rotated", false, "take lines from rotated files when the current log has less than N lines")
+	catLogCmd.Flags().IntVarP(&logFlags.catLines, "lines", "n", 0, "output the last N lines, 0 for all")
+	catLogCmd.Flags().BoolVarP(&logFlags.page, "page", "p", false, "pause after each page")
+	catLogCmd.Flags().IntVar(&logFlags.pageSize, "page-size", 0, "lines per page, default terminal height")
+	for _, c := range []*cobra.Command{logCmd, catLogCmd, lsLogCmd} {
+		c.SilenceUsage = true
+	}
 	logCmd.AddCommand(catLogCmd)
 	logCmd.AddCommand(lsLogCmd)
 	RootCmd.AddCommand(logCmd)
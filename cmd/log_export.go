@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// 导出参数
+var exportFlags = struct {
+	since  string
+	output string
+}{}
+
+// ManifestEntry 导出包中的文件
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest 导出包的文件清单,Skipped 记录未能导出的内容及原因
+type Manifest struct {
+	App     string            `json:"app"`
+	Version string            `json:"version"`
+	Host    string            `json:"host"`
+	Created time.Time         `json:"created"`
+	Since   time.Time         `json:"since"`
+	Files   []ManifestEntry   `json:"files"`
+	Skipped map[string]string `json:"skipped,omitempty"`
+}
+
+// bundleWriter 写入 tar.gz 并记录清单
+type bundleWriter struct {
+	tw       *tar.Writer
+	manifest *Manifest
+}
+
+func (b *bundleWriter) skip(name string, err error) {
+	if b.manifest.Skipped == nil {
+		b.manifest.Skipped = map[string]string{}
+	}
+	b.manifest.Skipped[name] = err.Error()
+}
+
+// addData 写入内存中的数据
+func (b *bundleWriter) addData(name string, data []byte, mtime time.Time) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: mtime}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		return err
+	}
+	b.manifest.Files = append(b.manifest.Files, ManifestEntry{Name: name, Size: hdr.Size})
+	return nil
+}
+
+// addJSON 写入格式化的 json
+func (b *bundleWriter) addJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.addData(name, append(data, '\n'), time.Now())
+}
+
+// addFile 写入文件,保留原始内容(压缩文件不解压)
+func (b *bundleWriter) addFile(name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// 当前日志可能仍在写入,只导出打开时的大小
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err = b.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(b.tw, f, hdr.Size); err != nil {
+		return err
+	}
+	b.manifest.Files = append(b.manifest.Files, ManifestEntry{Name: name, Source: path, Size: hdr.Size})
+	return nil
+}
+
+// versionInfo 程序版本和构建信息
+func versionInfo() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "app: %s\nversion: %s\ngo: %s\nos/arch: %s/%s\n", svcName(), Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&buf, "module: %s %s\n", bi.Main.Path, bi.Main.Version)
+		for _, s := range bi.Settings {
+			fmt.Fprintf(&buf, "%s: %s\n", s.Key, s.Value)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ipcJSON 通过 IPC 读取运行中服务的数据
+func ipcJSON(name string) (json.RawMessage, error) {
+	resp, err := CallIPC(name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("service not running: %w", err)
+	}
+	if err = resp.Err(); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// crashFiles 返回工作目录和程序目录下的 panic.log/stderr.log
+func crashFiles() []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, dir := range []string{".", tools.CurrentDir()} {
+		for _, name := range []string{"panic.log", "stderr.log"} {
+			path, err := filepath.Abs(filepath.Join(dir, name))
+			if err != nil || seen[path] || !tools.FileExists(path) {
+				continue
+			}
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// daemonOutFiles 返回日志目录下守护进程和 init 系统重定向的输出 <name>.out
+func daemonOutFiles() []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, name := range []string{tools.CurrentName(), svcName()} {
+		path := filepath.Join(defOpt.logPath, name+".out")
+		if seen[path] || !tools.FileExists(path) {
+			continue
+		}
+		seen[path] = true
+		files = append(files, path)
+	}
+	return files
+}
+
+// exportBundle 打包 since 之后写入的日志、崩溃和守护进程输出、配置、版本和运行状态
+func exportBundle(w io.Writer, since time.Time) (*Manifest, error) {
+	host, _ := os.Hostname()
+	m := &Manifest{App: svcName(), Version: Version, Host: host, Created: time.Now(), Since: since}
+	gz := gzip.NewWriter(w)
+	b := &bundleWriter{tw: tar.NewWriter(gz), manifest: m}
+
+	parts, err := logParts()
+	if err != nil {
+		b.skip("logs", err)
+	}
+	for _, p := range parts {
+		// 最后写入时间早于 since 的文件不包含需要的日志
+		if info, err := os.Stat(p.path); err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		if err = b.addFile("logs/"+filepath.Base(p.path), p.path); err != nil {
+			return m, err
+		}
+	}
+	for _, path := range crashFiles() {
+		name := filepath.Base(path)
+		if filepath.Dir(path) != filepath.Clean(tools.CurrentDir()) {
+			name = "cwd-" + name
+		}
+		if err = b.addFile(name, path); err != nil {
+			return m, err
+		}
+	}
+	for _, path := range daemonOutFiles() {
+		if err = b.addFile("logs/"+filepath.Base(path), path); err != nil {
+			return m, err
+		}
+	}
+	if err = b.addData("version.txt", versionInfo(), time.Now()); err != nil {
+		return m, err
+	}
+	for _, name := range []string{"config", "stats"} {
+		data, err := ipcJSON(name)
+		if err != nil {
+			b.skip(name+".json", err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err = json.Indent(&buf, data, "", "  "); err != nil {
+			b.skip(name+".json", err)
+			continue
+		}
+		buf.WriteByte('\n')
+		if err = b.addData(name+".json", buf.Bytes(), time.Now()); err != nil {
+			return m, err
+		}
+	}
+	// 清单最后写入,包含以上所有文件
+	if err = b.addJSON("manifest.json", m); err != nil {
+		return m, err
+	}
+	if err = b.tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+var exportLogCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export support bundle",
+	Long: `export logs, panic.log, stderr.log, redacted config, version and stats to a tar.gz bundle
+  --since: 10:00, 2006-01-02, "2006-01-02 15:04", RFC3339 or duration like 2h`,
+	Example: "  app log export --since 2h -o bundle.tar.gz",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		since, err := parseLogTime(exportFlags.since, now)
+		if err != nil {
+			return err
+		}
+		output := exportFlags.output
+		if output == "" {
+			output = fmt.Sprintf("%s-%s.tar.gz", svcName(), now.Format("20060102-150405"))
+		}
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		m, err := exportBundle(f, since)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(output)
+			return err
+		}
+		for _, e := range m.Files {
+			fmt.Printf("%8s  %s\n", fmtBytes(uint64(e.Size)), e.Name)
+		}
+		names := make([]string, 0, len(m.Skipped))
+		for name := range m.Skipped {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("skipped %s: %s\n", name, m.Skipped[name])
+		}
+		fmt.Println("export to", output)
+		return nil
+	},
+}
+
+func init() {
+	exportLogCmd.Flags().StringVar(&exportFlags.since, "since", "24h", "include logs written after the time")
+	exportLogCmd.Flags().StringVarP(&exportFlags.output, "output", "o", "", "output file, default <name>-<time>.tar.gz")
+	exportLogCmd.SilenceUsage = true
+	logCmd.AddCommand(exportLogCmd)
+}
@@ -0,0 +1,343 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools"
+	"go.uber.org/zap/zapcore"
+)
+
+// 日志中 tm 字段只有时间,日期取自文件名
+const logTimeLayout = "150405.000"
+
+// 日志搜索参数
+var grepFlags = struct {
+	level  string
+	since  string
+	until  string
+	fields []string
+	regex  string
+}{}
+
+var grepLogCmd = &cobra.Command{
+	Use:   "grep",
+	Short: "search log",
+	Long: `search current and rotated log files in chronological order
+  --since/--until: 10:00, 10:00:05, 2006-01-02, "2006-01-02 15:04", 20060102, RFC3339 or duration like 2h
+  --regex matches the whole json line`,
+	Example: "  app log grep --level warn --since 10:00 --until 11:30 --field reqId=abc --regex timeout",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := newLogFilter(time.Now())
+		if err != nil {
+			return err
+		}
+		parts, err := logParts()
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+		return grepLog(w, parts, f, newLogRenderer(os.Stdout))
+	},
+}
+
+// logPart 日志文件及其日期,当前日志的序号为 0
+type logPart struct {
+	path string
+	day  time.Time
+	n    int
+}
+
+// parseBackupName 解析切割文件名 <prefix>_<yyyyMMdd>.<N>.log[.gz|.xz|.zst]
+func parseBackupName(name, prefix, ext string) (day time.Time, n int, ok bool) {
+	name = trimCompressExt(name)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+		return day, 0, false
+	}
+	s := name[len(prefix) : len(name)-len(ext)]
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return day, 0, false
+	}
+	day, err := time.ParseInLocation("20060102", s[:i], time.Local)
+	if err != nil {
+		return day, 0, false
+	}
+	n = tools.AtoI(s[i+1:])
+	return day, n, n > 0
+}
+
+// logParts 返回当前日志和 oldLogFiles 找到的切割文件,按时间从旧到新排序
+func logParts() ([]logPart, error) {
+	l := NewSplit(activeLogPath(), OptCompressType(defOpt.compressType))
+	files, err := l.oldLogFiles()
+	if err != nil {
+		return nil, err
+	}
+	prefix, ext := l.prefixAndExt()
+	var parts []logPart
+	for _, f := range files {
+		if day, n, ok := parseBackupName(f.Name(), prefix, ext); ok {
+			parts = append(parts, logPart{filepath.Join(l.dir, f.Name()), day, n})
+		}
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if !parts[i].day.Equal(parts[j].day) {
+			return parts[i].day.Before(parts[j].day)
+		}
+		return parts[i].n < parts[j].n
+	})
+	if info, err := os.Stat(l.filename); err == nil {
+		parts = append(parts, logPart{l.filename, activeLogDay(l.filename, info.ModTime()), 0})
+	}
+	return parts, nil
+}
+
+// activeLogDay 当前日志开始写入的日期
+// 不在零点切割时文件会跨天,按第一条日志的时间和最后写入时间推算,第一条日志的时间晚于最后写入时间说明从前一天开始
+// 没有带时间的日志时使用最后写入日期
+func activeLogDay(path string, mtime time.Time) time.Time {
+	day := startOfDay(mtime)
+	f, err := os.Open(path)
+	if err != nil {
+		return day
+	}
+	defer f.Close()
+	br := bufio.NewReader(io.LimitReader(f, 64*1024))
+	for {
+		line, err := br.ReadBytes('\n')
+		if e, ok := parseLogLine(line, day); ok && !e.time.IsZero() {
+			if e.time.After(mtime) {
+				return day.AddDate(0, 0, -1)
+			}
+			return day
+		}
+		if err != nil {
+			return day
+		}
+	}
+}
+
+// parseLogTime 解析时间参数,只有时间时为当天,duration 为 now 之前
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "20060102", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// logFilter 日志过滤条件
+type logFilter struct {
+	level        zapcore.Level
+	hasLevel     bool
+	since, until time.Time
+	fields       map[string]string
+	re           *regexp.Regexp
+}
+
+func newLogFilter(now time.Time) (*logFilter, error) {
+	f := &logFilter{fields: map[string]string{}}
+	var err error
+	if grepFlags.level != "" {
+		if f.level, err = zapcore.ParseLevel(grepFlags.level); err != nil {
+			return nil, err
+		}
+		f.hasLevel = true
+	}
+	if grepFlags.since != "" {
+		if f.since, err = parseLogTime(grepFlags.since, now); err != nil {
+			return nil, err
+		}
+	}
+	if grepFlags.until != "" {
+		if f.until, err = parseLogTime(grepFlags.until, now); err != nil {
+			return nil, err
+		}
+	}
+	for _, kv := range grepFlags.fields {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid field %q, expect key=value", kv)
+		}
+		f.fields[k] = v
+	}
+	if grepFlags.regex != "" {
+		if f.re, err = regexp.Compile(grepFlags.regex); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// skipDay 从 day 开始的文件都不在时间范围内,不在零点切割时文件最多跨到第二天
+func (f *logFilter) skipDay(day time.Time) bool {
+	if !f.since.IsZero() && !day.AddDate(0, 0, 2).After(f.since) {
+		return true
+	}
+	return !f.until.IsZero() && day.After(f.until)
+}
+
+// structured 是否有需要解析 json 的条件
+func (f *logFilter) structured() bool {
+	return f.hasLevel || !f.since.IsZero() || !f.until.IsZero() || len(f.fields) > 0
+}
+
+// logEntry 解析后的日志行
+type logEntry struct {
+	time   time.Time
+	fields map[string]any
+}
+
+// parseLogLine 解析 json 日志行,day 为日志所在文件的日期
+func parseLogLine(line []byte, day time.Time) (*logEntry, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return nil, false
+	}
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.UseNumber()
+	e := &logEntry{}
+	if err := d.Decode(&e.fields); err != nil {
+		return nil, false
+	}
+	if tm, ok := e.fields["tm"].(string); ok {
+		if t, err := time.ParseInLocation(logTimeLayout, tm, time.Local); err == nil {
+			// 未知日期时保留年份为 0 的时间
+			e.time = t
+			if !day.IsZero() {
+				e.time = time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+			}
+		}
+	}
+	return e, true
+}
+
+// fieldString 字段值转为字符串,字符串不带引号
+func fieldString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// match 日志行是否满足条件,非 json 行只在没有结构化条件时匹配
+func (f *logFilter) match(line []byte, e *logEntry) bool {
+	if f.re != nil && !f.re.Match(line) {
+		return false
+	}
+	if !f.structured() {
+		return true
+	}
+	if e == nil {
+		return false
+	}
+	if f.hasLevel {
+		var lvl zapcore.Level
+		if s, ok := e.fields["level"].(string); !ok || lvl.UnmarshalText([]byte(s)) != nil || lvl < f.level {
+			return false
+		}
+	}
+	if !f.since.IsZero() && (e.time.IsZero() || e.time.Before(f.since)) {
+		return false
+	}
+	if !f.until.IsZero() && (e.time.IsZero() || e.time.After(f.until)) {
+		return false
+	}
+	for k, v := range f.fields {
+		fv, ok := e.fields[k]
+		if !ok || fieldString(fv) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// grepLog 按顺序搜索日志文件并输出匹配的行
+func grepLog(w io.Writer, parts []logPart, f *logFilter, r *logRenderer) error {
+	for _, p := range parts {
+		if f.skipDay(p.day) {
+			continue
+		}
+		rd, err := openLog(p.path)
+		if err != nil {
+			return err
+		}
+		err = grepReader(w, rd, p.day, f, r)
+		rd.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.path, err)
+		}
+	}
+	return nil
+}
+
+func grepReader(w io.Writer, rd io.Reader, day time.Time, f *logFilter, r *logRenderer) error {
+	br := bufio.NewReader(rd)
+	var last time.Time
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			e, _ := parseLogLine(line, day)
+			// 不在零点切割时一个文件会跨天,时间倒退说明已经到了第二天
+			if e != nil && !e.time.IsZero() {
+				if e.time.Before(last.Add(-12 * time.Hour)) {
+					day = day.AddDate(0, 0, 1)
+					e, _ = parseLogLine(line, day)
+				}
+				last = e.time
+			}
+			if f.match(line, e) {
+				var werr error
+				if r == nil || e == nil {
+					if line[len(line)-1] != '\n' {
+						line = append(line, '\n')
+					}
+					_, werr = w.Write(line)
+				} else {
+					werr = r.render(w, e)
+				}
+				if werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func init() {
+	grepLogCmd.Flags().StringVar(&grepFlags.level, "level", "", "minimum level: debug, info, warn, error")
+	grepLogCmd.Flags().StringVar(&grepFlags.since, "since", "", "show entries not older than the time")
+	grepLogCmd.Flags().StringVar(&grepFlags.until, "until", "", "show entries not newer than the time")
+	grepLogCmd.Flags().StringArrayVar(&grepFlags.fields, "field", nil, "key=value, can be repeated")
+	grepLogCmd.Flags().StringVar(&grepFlags.regex, "regex", "", "regular expression")
+	grepLogCmd.SilenceUsage = true
+	logCmd.AddCommand(grepLogCmd)
+}
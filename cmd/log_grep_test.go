@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBackupName(t *testing.T) {
+	day, n, ok := parseBackupName("app_20240102.3.log.xz", "app_", ".log")
+	if !ok || n != 3 || day.Format("20060102") != "20240102" {
+		t.Fatal(day, n, ok)
+	}
+	for _, name := range []string{"app.log", "app_x.log", "app_20240102.log", "app_20240102.1.txt", "other_20240102.1.log"} {
+		if _, _, ok := parseBackupName(name, "app_", ".log"); ok {
+			t.Fatal("unexpected match", name)
+		}
+	}
+}
+
+func TestGrepLog(t *testing.T) {
+	dir := t.TempDir()
+	day1 := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"level":"warn","tm":"100000.000","msg":"timeout a","reqId":"abc"}
+{"level":"info","tm":"103000.000","msg":"timeout b","reqId":"abc"}
+not json timeout
+`))
+	gz.Close()
+	old := filepath.Join(dir, "app_20240102.1.log.gz")
+	os.WriteFile(old, buf.Bytes(), 0644)
+	cur := filepath.Join(dir, "app.log")
+	os.WriteFile(cur, []byte(`{"level":"error","tm":"090000.000","msg":"timeout c","reqId":"abc","n":1}
+{"level":"error","tm":"120000.000","msg":"timeout d","reqId":"xyz"}`), 0644)
+	parts := []logPart{{old, day1, 1}, {cur, day2, 0}}
+
+	grep := func(level, since, until, regex string, fields ...string) string {
+		grepFlags.level, grepFlags.since, grepFlags.until, grepFlags.regex, grepFlags.fields = level, since, until, regex, fields
+		f, err := newLogFilter(day2.Add(13 * time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := grepLog(&out, parts, f, nil); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	count := func(s string) int {
+		return bytes.Count([]byte(s), []byte("\n"))
+	}
+
+	if n := count(grep("", "", "", "timeout")); n != 5 {
+		t.Fatal("regex", n)
+	}
+	if n := count(grep("warn", "", "", "")); n != 3 {
+		t.Fatal("level", n)
+	}
+	if out := grep("", "2024-01-02 10:10", "2024-01-03 11:30", "", "reqId=abc"); count(out) != 2 {
+		t.Fatal("range", out)
+	}
+	if out := grep("", "", "", "", "n=1"); count(out) != 1 {
+		t.Fatal("number field", out)
+	}
+	// 时间只有时分时为当天,2h 为 11:00 之后
+	if out := grep("", "2h", "", ""); count(out) != 1 {
+		t.Fatal("duration", out)
+	}
+	if out := grep("", "08:00", "", ""); count(out) != 2 {
+		t.Fatal("clock", out)
+	}
+}
+
+func TestActiveLogDay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		content string
+		mtime   time.Time
+		want    time.Time
+	}{
+		// RotateDaily(6, 0) 从前一天 06:00 开始写入
+		{"{\"tm\":\"060000.000\"}\n", day.Add(5 * time.Hour), day.AddDate(0, 0, -1)},
+		{"{\"tm\":\"060000.000\"}\n", day.Add(7 * time.Hour), day},
+		{"not json\n{\"tm\":\"233000.000\"}\n", day.Add(30 * time.Minute), day.AddDate(0, 0, -1)},
+		{"not json\n", day.Add(5 * time.Hour), day},
+	}
+	for i, c := range cases {
+		os.WriteFile(path, []byte(c.content), 0644)
+		if got := activeLogDay(path, c.mtime); !got.Equal(c.want) {
+			t.Fatal(i, got)
+		}
+	}
+}
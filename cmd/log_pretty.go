@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日志输出格式参数
+var formatFlags = struct {
+	raw, pretty bool
+}{}
+
+// 终端颜色
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// 消息对齐宽度,超过时不补空格
+const prettyMsgWidth = 40
+
+// 展开显示的堆栈字段
+var stackKeys = map[string]bool{"stacktrace": true, "stack": true}
+
+// logRenderer 将 json 日志渲染为对齐的文本
+type logRenderer struct {
+	color bool
+}
+
+// newLogRenderer 根据 --raw/--pretty 选择输出格式,都未指定时输出到终端才渲染
+// 渲染时只在终端且未设置 NO_COLOR 时使用颜色,不渲染返回 nil
+func newLogRenderer(f *os.File) *logRenderer {
+	tty := isTerminal(f)
+	if formatFlags.raw || (!formatFlags.pretty && !tty) {
+		return nil
+	}
+	return &logRenderer{color: tty && os.Getenv("NO_COLOR") == ""}
+}
+
+func (r *logRenderer) paint(b *strings.Builder, color, s string) {
+	if r.color && color != "" {
+		b.WriteString(color + s + colorReset)
+		return
+	}
+	b.WriteString(s)
+}
+
+func levelColor(level string) string {
+	switch level {
+	case "debug":
+		return colorMagenta
+	case "info":
+		return colorBlue
+	case "warn":
+		return colorYellow
+	case "":
+		return ""
+	}
+	return colorRed
+}
+
+// fieldText 字段值,包含空白或引号的字符串加引号
+func fieldText(v any) string {
+	s, ok := v.(string)
+	if !ok {
+		return fieldString(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// render 输出 时间 级别 调用位置 消息 key=value,堆栈字段逐行缩进显示
+func (r *logRenderer) render(w io.Writer, e *logEntry) error {
+	var b strings.Builder
+	switch {
+	case e.time.IsZero():
+		r.paint(&b, colorGray, fieldString(e.fields["tm"]))
+	case e.time.Year() == 0:
+		// 未知日期时只显示时间
+		r.paint(&b, colorGray, e.time.Format("15:04:05.000"))
+	default:
+		r.paint(&b, colorGray, e.time.Format("2006-01-02 15:04:05.000"))
+	}
+	level, _ := e.fields["level"].(string)
+	pad := ""
+	if len(level) < 5 {
+		pad = strings.Repeat(" ", 5-len(level))
+	}
+	b.WriteByte(' ')
+	r.paint(&b, levelColor(level), strings.ToUpper(level)+pad)
+	if caller, ok := e.fields["caller"].(string); ok {
+		b.WriteByte(' ')
+		r.paint(&b, colorGray, caller)
+	}
+	msg, _ := e.fields["msg"].(string)
+	b.WriteString(" " + msg)
+
+	var keys, stacks []string
+	for k, v := range e.fields {
+		switch k {
+		case "tm", "level", "msg", "caller":
+			continue
+		}
+		if s, ok := v.(string); ok && (stackKeys[k] || strings.Contains(s, "\n")) {
+			stacks = append(stacks, k)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sort.Strings(stacks)
+	if len(keys) > 0 && len(msg) < prettyMsgWidth {
+		b.WriteString(strings.Repeat(" ", prettyMsgWidth-len(msg)))
+	}
+	for _, k := range keys {
+		b.WriteByte(' ')
+		r.paint(&b, colorCyan, k+"=")
+		b.WriteString(fieldText(e.fields[k]))
+	}
+	b.WriteByte('\n')
+	for _, k := range stacks {
+		r.paint(&b, colorCyan, "    "+k+":")
+		b.WriteByte('\n')
+		for _, line := range strings.Split(strings.TrimRight(e.fields[k].(string), "\n"), "\n") {
+			r.paint(&b, colorGray, "        "+line)
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// prettyWriter 按行渲染写入的 json 日志,非 json 行原样输出
+type prettyWriter struct {
+	w   io.Writer
+	r   *logRenderer
+	buf []byte
+}
+
+// prettyOutput 需要渲染时包装 w,返回的 flush 输出最后不完整的行
+func prettyOutput(w io.Writer, f *os.File) (io.Writer, func() error) {
+	r := newLogRenderer(f)
+	if r == nil {
+		return w, func() error { return nil }
+	}
+	p := &prettyWriter{w: w, r: r}
+	return p, p.Flush
+}
+
+func (p *prettyWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush 输出缓存中没有换行的内容
+func (p *prettyWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prettyWriter) writeLine(line []byte) error {
+	if e, ok := parseLogLine(line, time.Time{}); ok {
+		return p.r.render(p.w, e)
+	}
+	_, err := p.w.Write(line)
+	return err
+}
+
+func init() {
+	logCmd.PersistentFlags().BoolVar(&formatFlags.raw, "raw", false, "output raw json lines")
+	logCmd.PersistentFlags().BoolVar(&formatFlags.pretty, "pretty", false, "render json lines even if output is not a terminal")
+	logCmd.MarkFlagsMutuallyExclusive("raw", "pretty")
+}
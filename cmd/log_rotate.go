@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"time"
+)
+
+type rotatePeriod int
+
+const (
+	rotateNone rotatePeriod = iota
+	rotateHourly
+	rotateDaily
+	rotateMinutes
+)
+
+// LogRotation 日志切割策略,使用 RotateHourly/RotateDaily/RotateEvery/RotateSize 创建
+// 按时间切割的策略可以通过 OrSize 同时按 WithLogMaxSize 大小切割
+type LogRotation struct {
+	period rotatePeriod
+	// rotateDaily 时距离零点的时间
+	at time.Duration
+	// rotateMinutes 时的间隔
+	every time.Duration
+	// 超过最大大小时切割
+	size bool
+}
+
+// RotateHourly 每小时整点切割
+func RotateHourly() LogRotation {
+	return LogRotation{period: rotateHourly}
+}
+
+// RotateDaily 每天在本地时间 hour:minute 切割
+func RotateDaily(hour, minute int) LogRotation {
+	if hour < 0 || hour > 23 {
+		hour = 0
+	}
+	if minute < 0 || minute > 59 {
+		minute = 0
+	}
+	return LogRotation{period: rotateDaily, at: time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute}
+}
+
+// RotateEvery 每 minutes 分钟切割,从每天零点开始对齐
+func RotateEvery(minutes int) LogRotation {
+	if minutes <= 0 {
+		minutes = 1
+	}
+	return LogRotation{period: rotateMinutes, every: time.Duration(minutes) * time.Minute}
+}
+
+// RotateSize 只按大小切割
+func RotateSize() LogRotation {
+	return LogRotation{period: rotateNone, size: true}
+}
+
+// OrSize 按时间或大小切割,先满足哪个条件就切割
+func (r LogRotation) OrSize() LogRotation {
+	r.size = true
+	return r
+}
+
+// defLogRotation 默认每天零点或超过大小时切割
+func defLogRotation() LogRotation {
+	return RotateDaily(0, 0).OrSize()
+}
+
+// orDefault 零值既不按时间也不按大小切割,使用默认策略
+func (r LogRotation) orDefault() LogRotation {
+	if r == (LogRotation{}) {
+		return defLogRotation()
+	}
+	return r
+}
+
+// startOfDay 本地时间当天零点
+func startOfDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// next 返回 t 之后的下一次切割时间,不按时间切割时返回零值
+func (r LogRotation) next(t time.Time) time.Time {
+	t = t.Local()
+	day := startOfDay(t)
+	switch r.period {
+	case rotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.Local)
+	case rotateDaily:
+		// 使用日期计算,夏令时切换当天也在指定的本地时间切割
+		h, m := int(r.at/time.Hour), int(r.at%time.Hour/time.Minute)
+		next := time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, time.Local)
+		if !next.After(t) {
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, h, m, 0, 0, time.Local)
+		}
+		return next
+	case rotateMinutes:
+		n := t.Sub(day)/r.every + 1
+		next := day.Add(n * r.every)
+		// 每天零点重新对齐
+		if tomorrow := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.Local); next.After(tomorrow) {
+			next = tomorrow
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// due 从 start 开始写入的文件在 now 时是否需要按时间切割
+func (r LogRotation) due(start, now time.Time) bool {
+	next := r.next(start)
+	return !next.IsZero() && !now.Before(next)
+}
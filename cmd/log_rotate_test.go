@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotationNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	cases := []struct {
+		r    LogRotation
+		from string
+		next string
+	}{
+		{RotateHourly(), "2026-01-31 23:10", "2026-02-01 00:00"},
+		{RotateDaily(0, 0), "2026-09-18 10:00", "2026-09-19 00:00"},
+		{RotateDaily(6, 30), "2026-12-31 05:00", "2026-12-31 06:30"},
+		{RotateDaily(6, 30), "2026-12-31 06:30", "2027-01-01 06:30"},
+		{RotateEvery(15), "2026-03-01 10:07", "2026-03-01 10:15"},
+		{RotateEvery(15), "2026-03-01 10:15", "2026-03-01 10:30"},
+		// 不能整除时在零点重新对齐
+		{RotateEvery(7 * 60), "2026-03-01 22:00", "2026-03-02 00:00"},
+	}
+	for _, c := range cases {
+		if got := c.r.next(at(c.from)); !got.Equal(at(c.next)) {
+			t.Errorf("%+v from %s: got %s want %s", c.r, c.from, got, c.next)
+		}
+	}
+	if !RotateSize().next(time.Now()).IsZero() {
+		t.Fatal("size only rotation should not have next time")
+	}
+	// 不同月份的同一天也需要切割
+	if !RotateDaily(0, 0).due(at("2026-09-18 10:00"), at("2026-10-18 09:00")) {
+		t.Fatal("expect due")
+	}
+	if RotateHourly().due(at("2026-10-18 10:00"), at("2026-10-18 10:59")) {
+		t.Fatal("unexpected due")
+	}
+}
+
+func TestRotateExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	os.WriteFile(name, []byte("old\n"), 0644)
+	// 上个月的同一天写入的文件
+	mtime := time.Now().AddDate(0, -1, 0)
+	os.Chtimes(name, mtime, mtime)
+
+	l := NewSplit(name, OptCompressType(CT_NONE), OptMaxAge(0))
+	defer l.Close()
+	if _, err := l.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "app_"+mtime.Format("20060102")+".1.log")
+	if got := readFile(t, backup); got != "old\n" {
+		t.Fatalf("backup %q", got)
+	}
+	if got := readFile(t, name); got != "new\n" {
+		t.Fatalf("current %q", got)
+	}
+}
+
+func TestRotateExistingFileAcrossDays(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	os.WriteFile(name, []byte("{\"tm\":\"230000.000\"}\n"), 0644)
+	// 上个月前一天 23:00 开始写入,最后写入时间为次日 01:00
+	mtime := startOfDay(time.Now().AddDate(0, -1, 0)).Add(time.Hour)
+	os.Chtimes(name, mtime, mtime)
+
+	l := NewSplit(name, OptCompressType(CT_NONE), OptMaxAge(0))
+	defer l.Close()
+	if _, err := l.Write([]byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "app_"+mtime.AddDate(0, 0, -1).Format("20060102")+".1.log")
+	if _, err := os.Stat(backup); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZeroRotation(t *testing.T) {
+	opt := &cmdOpt{}
+	WithLogRotation(LogRotation{})(opt)
+	if opt.rotation != defLogRotation() {
+		t.Fatal(opt.rotation)
+	}
+	if r := RotateHourly().orDefault(); r != RotateHourly() {
+		t.Fatal(r)
+	}
+}
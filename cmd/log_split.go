@@ -1,11 +1,11 @@
 package cmd
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -13,6 +13,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 	"github.com/zhiyin2021/zycli/tools"
 )
 
@@ -25,8 +27,22 @@ const (
 	CT_NONE CompressType = ""
 	CT_GZ   CompressType = ".gz"
 	CT_XZ   CompressType = ".xz"
+	CT_ZST  CompressType = ".zst"
 )
 
+// compressTypes 支持读取的压缩格式
+var compressTypes = []CompressType{CT_GZ, CT_XZ, CT_ZST}
+
+// trimCompressExt 去掉压缩扩展名
+func trimCompressExt(name string) string {
+	for _, ct := range compressTypes {
+		if strings.HasSuffix(name, string(ct)) {
+			return name[:len(name)-len(ct)]
+		}
+	}
+	return name
+}
+
 type logWriter struct {
 	// Filename is the file to write logs to.  Backup log files will be retained
 	// in the same directory.  It uses <processname>-lumberjack.log in
@@ -69,6 +85,14 @@ type logWriter struct {
 
 	ctime time.Time
 	pos   int
+	// pos 对应的切割文件日期
+	posDay string
+	// 切割策略和下次按时间切割的时间
+	rotation   LogRotation
+	nextRotate time.Time
+
+	// 压缩和清理旧文件出错时的回调
+	errorHandler func(err error)
 }
 
 var (
@@ -97,6 +121,7 @@ func NewSplit(fileName string, opts ...logWriterOption) *logWriter {
 		millRuning: 0,
 		dir:        filepath.Dir(fileName),
 		pos:        0,
+		rotation:   defLogRotation(),
 	}
 	for _, opt := range opts {
 		opt(l)
@@ -132,6 +157,20 @@ func OptCompressType(compressType CompressType) logWriterOption {
 	}
 }
 
+// 切割策略,默认:每天零点或超过最大大小时切割,零值使用默认策略
+func OptRotation(rotation LogRotation) logWriterOption {
+	return func(l *logWriter) {
+		l.rotation = rotation.orDefault()
+	}
+}
+
+// 压缩和清理旧文件出错时的回调,默认输出到标准错误
+func OptErrorHandler(fn func(err error)) logWriterOption {
+	return func(l *logWriter) {
+		l.errorHandler = fn
+	}
+}
+
 // 切割文件时间格式,默认:060102150405.000
 // func OptLayout(layout string) logWriterOption {
 // 	return func(l *logWriter) {
@@ -148,7 +187,7 @@ func (l *logWriter) Write(p []byte) (n int, err error) {
 	defer l.mu.Unlock()
 
 	writeLen := int64(len(p))
-	if writeLen > l.maxSize {
+	if l.rotation.size && writeLen > l.maxSize {
 		return 0, fmt.Errorf(
 			"write length %d exceeds maximum file size %d", writeLen, l.maxSize,
 		)
@@ -161,13 +200,8 @@ func (l *logWriter) Write(p []byte) (n int, err error) {
 
 	}
 
-	if l.size+writeLen > l.maxSize {
-		if err := l.rotate(); err != nil {
-			return 0, err
-		}
-	}
-	if l.ctime.Day() != time.Now().Day() {
-		l.pos = 0
+	timeDue := !l.nextRotate.IsZero() && !time.Now().Before(l.nextRotate)
+	if timeDue || (l.rotation.size && l.size+writeLen > l.maxSize) {
 		if err := l.rotate(); err != nil {
 			return 0, err
 		}
@@ -250,39 +284,57 @@ func (l *logWriter) openNew() error {
 	// we use truncate here because this should only get called when we've moved
 	// the file ourselves. if someone else creates the file in the meantime,
 	// just wipe out the contents.
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, mode)
 	if err != nil {
 		return fmt.Errorf("can't open new logfile: %s", err)
 	}
 	l.file = f
 	l.size = 0
 	l.ctime = time.Now()
+	l.nextRotate = l.rotation.next(l.ctime)
 	return nil
 }
 
-// backupName creates a new filename from the given name, inserting a timestamp
-// between the filename and the extension, using the local time if requested
-// (otherwise UTC).
+// backupName creates a new filename from the given name, inserting the local
+// date the file was started on and a sequence number between the filename and
+// the extension.
 func (l *logWriter) backupName(name string) string {
 	dir := filepath.Dir(name)
 	filename := filepath.Base(name)
 	ext := filepath.Ext(filename)
 	prefix := filename[:len(filename)-len(ext)]
 
-	if l.ctime.Day() != time.Now().Day() {
-		l.ctime = time.Now()
+	start := l.ctime
+	if start.IsZero() {
+		start = time.Now()
+	}
+	timestamp := start.Local().Format("20060102")
+	if timestamp != l.posDay {
+		l.posDay = timestamp
 		l.pos = 0
 	}
-	timestamp := l.ctime.Format("20060102")
 	for {
 		l.pos++
 		logPath := filepath.Join(dir, fmt.Sprintf("%s_%s.%d%s", prefix, timestamp, l.pos, ext))
-		if _, err := osStat(logPath + string(l.compressType)); err != nil {
+		if !backupExists(logPath) {
 			return logPath
 		}
 	}
 }
 
+// backupExists 切割文件或其压缩文件是否存在
+func backupExists(logPath string) bool {
+	if _, err := osStat(logPath); err == nil {
+		return true
+	}
+	for _, ct := range compressTypes {
+		if _, err := osStat(logPath + string(ct)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // openExistingOrNew opens the logfile if it exists and if the current write
 // would not put it over MaxSize.  If there is no such file or the write would
 // put it over the MaxSize, a new file is created.
@@ -298,10 +350,12 @@ func (l *logWriter) openExistingOrNew(writeLen int) error {
 		return fmt.Errorf("error getting log file info: %s", err)
 	}
 
-	if info.Size()+int64(writeLen) >= l.maxSize {
+	// 切割文件名使用已有文件第一条日志的日期,文件可能跨天写入
+	l.ctime = activeLogDay(filename, info.ModTime())
+	if l.rotation.size && info.Size()+int64(writeLen) >= l.maxSize {
 		return l.rotate()
 	}
-	if info.ModTime().Day() != time.Now().Day() {
+	if l.rotation.due(info.ModTime(), time.Now()) {
 		return l.rotate()
 	}
 	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
@@ -312,7 +366,7 @@ func (l *logWriter) openExistingOrNew(writeLen int) error {
 	}
 	l.file = file
 	l.size = info.Size()
-	l.ctime = info.ModTime()
+	l.nextRotate = l.rotation.next(info.ModTime())
 	return nil
 }
 
@@ -340,11 +394,7 @@ func (l *logWriter) millRunOnce() error {
 			for _, f := range files {
 				// Only count the uncompressed log file or the
 				// compressed log file, not both.
-				fn := f.Name()
-				if ok := strings.HasSuffix(fn, string(l.compressType)); ok {
-					fn = fn[:len(fn)-len(l.compressType)]
-				}
-				preserved[fn] = true
+				preserved[trimCompressExt(f.Name())] = true
 
 				if len(preserved) > l.maxCount {
 					remove = append(remove, f)
@@ -371,7 +421,8 @@ func (l *logWriter) millRunOnce() error {
 
 		if l.compressType != CT_NONE {
 			for _, f := range files {
-				if !strings.HasSuffix(f.Name(), string(l.compressType)) {
+				// 已经用其他格式压缩的文件不再压缩
+				if trimCompressExt(f.Name()) == f.Name() {
 					compress = append(compress, f)
 				}
 			}
@@ -399,9 +450,19 @@ func (l *logWriter) millRunOnce() error {
 // of old log files.
 func (l *logWriter) millRun() {
 	for range l.millCh {
-		// what am I going to do, log this?
-		_ = l.millRunOnce()
+		if err := l.millRunOnce(); err != nil {
+			l.reportError(err)
+		}
+	}
+}
+
+// reportError 报告压缩和清理旧文件时的错误,未设置 OptErrorHandler 时输出到标准错误
+func (l *logWriter) reportError(err error) {
+	if l.errorHandler != nil {
+		l.errorHandler(err)
+		return
 	}
+	fmt.Fprintln(os.Stderr, "log mill:", err)
 }
 
 // mill performs post-rotation compression and removal of stale log files,
@@ -438,7 +499,7 @@ func (l *logWriter) oldLogFiles() ([]fs.FileInfo, error) {
 		// 	continue
 		// }
 		fname := fi.Name()
-		if strings.HasPrefix(fname, prefix) && (strings.HasSuffix(fname, ext) || strings.HasSuffix(fname, ext+string(l.compressType))) {
+		if strings.HasPrefix(fname, prefix) && strings.HasSuffix(trimCompressExt(fname), ext) {
 			logFiles = append(logFiles, fi)
 			continue
 		}
@@ -460,117 +521,80 @@ func (l *logWriter) prefixAndExt() (prefix, ext string) {
 	return prefix, ext
 }
 func (l *logWriter) compress(src, dst string) (err error) {
-	switch l.compressType {
-	case CT_GZ:
-		return gzcompress(src, dst)
-	case CT_XZ:
-		return xzcompress(src, dst)
-	default:
+	if l.compressType == CT_NONE {
 		return nil
 	}
+	return compressFile(src, dst, l.compressType)
 }
 
-// compressLogFile compresses the given log file, removing the
-// uncompressed log file if successful.
-func gzcompress(src, dst string) (err error) {
-	return exec.Command("gzip", src).Start()
-	// f, err := os.Open(src)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to open log file: %v", err)
-	// }
-	// defer f.Close()
-
-	// fi, err := osStat(src)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to stat log file: %v", err)
-	// }
-
-	// if err := tools.Chown(dst, fi); err != nil {
-	// 	return fmt.Errorf("failed to chown compressed log file: %v", err)
-	// }
-
-	// // If this file already exists, we presume it was created by
-	// // a previous attempt to compress the log file.
-	// gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
-	// if err != nil {
-	// 	return fmt.Errorf("failed to open compressed log file: %v", err)
-	// }
-	// defer gzf.Close()
-
-	// gz := gzip.NewWriter(gzf)
-
-	// defer func() {
-	// 	if err != nil {
-	// 		os.Remove(dst)
-	// 		err = fmt.Errorf("failed to compress log file: %v", err)
-	// 	}
-	// }()
-
-	// if _, err := io.Copy(gz, f); err != nil {
-	// 	return err
-	// }
-	// if err := gz.Close(); err != nil {
-	// 	return err
-	// }
-	// if err := gzf.Close(); err != nil {
-	// 	return err
-	// }
-
-	// if err := f.Close(); err != nil {
-	// 	return err
-	// }
-	// if err := os.Remove(src); err != nil {
-	// 	return err
-	// }
-
-	// return nil
+// newCompressor 创建对应格式的压缩 writer
+func newCompressor(w io.Writer, ct CompressType) (io.WriteCloser, error) {
+	switch ct {
+	case CT_GZ:
+		return gzip.NewWriter(w), nil
+	case CT_XZ:
+		return xz.NewWriter(w)
+	case CT_ZST:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown compress type %q", ct)
 }
-func xzcompress(src, dst string) (err error) {
-	return exec.Command("xz", "-z", src).Start()
-	// f, err := os.Open(src)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to open log file: %v", err)
-	// }
-	// defer func() {
-	// 	f.Close()
-	// 	if err == nil {
-	// 		os.Remove(src)
-	// 	}
-	// }()
-	// fi, err := osStat(src)
-	// if err != nil {
-	// 	return fmt.Errorf("failed to stat log file: %v", err)
-	// }
-
-	// if err := tools.Chown(dst, fi); err != nil {
-	// 	return fmt.Errorf("failed to chown compressed log file: %v", err)
-	// }
-
-	// // If this file already exists, we presume it was created by
-	// // a previous attempt to compress the log file.
-	// xzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
-	// if err != nil {
-	// 	return fmt.Errorf("failed to open compressed log file: %v", err)
-	// }
-	// defer func() {
-	// 	xzf.Close()
-	// 	if err != nil {
-	// 		os.Remove(dst)
-	// 		err = fmt.Errorf("failed to compress log file: %v", err)
-	// 	}
-	// }()
-	// // const text = "The quick brown fox jumps over the lazy dog.\n"
-	// // var buf bytes.Buffer
-	// // // compress text
-	// xzFile, err := xz.NewWriter(xzf)
-	// if err != nil {
-	// 	return err
-	// }
-	// defer xzFile.Close()
-	// if _, err := io.Copy(xzFile, f); err != nil {
-	// 	return err
-	// }
-	// return nil
+
+// compressFile 将 src 压缩为 dst 后删除 src
+// 先写入同目录的临时文件再改名,保留 src 的权限、属主和修改时间
+func compressFile(src, dst string, ct CompressType) (err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat log file: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create compressed log file: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			err = fmt.Errorf("failed to compress log file %s: %v", src, err)
+		}
+	}()
+	// Chown 会截断文件,需要在写入前调用
+	if err = tools.Chown(tmp.Name(), fi); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(fi.Mode()); err != nil {
+		return err
+	}
+	w, err := newCompressor(tmp, ct)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, f); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp.Name(), fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
 }
 
 // byFormatTime sorts by newest time formatted in the name.
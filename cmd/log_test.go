@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+var errFollowDone = errors.New("done")
+
+// followOutput 收集输出,出现 until 后返回错误结束跟踪
+type followOutput struct {
+	mu    sync.Mutex
+	b     strings.Builder
+	until string
+}
+
+func (o *followOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.b.Write(p)
+	if strings.Contains(o.b.String(), o.until) {
+		return len(p), errFollowDone
+	}
+	return len(p), nil
+}
+
+func TestFollowFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog := func(s string) {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+		time.Sleep(2 * followInterval)
+	}
+	appendLog("old\n")
+
+	out := &followOutput{until: "end\n"}
+	done := make(chan error, 1)
+	go func() {
+		done <- tailFile(out, path, 1, true, false)
+	}()
+	time.Sleep(followInterval)
+	appendLog("a\n")
+	// 切割: 改名后创建新文件
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog("b\n")
+	// 截断
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * followInterval)
+	appendLog("end\n")
+
+	select {
+	case err := <-done:
+		if err != errFollowDone {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout %q", out.b.String())
+	}
+	if got := out.b.String(); got != "old\na\nb\nend\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestParseDayRange(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	cases := map[string][2]string{
+		"20260215":           {"20260215", "20260215"},
+		"2026-02-15":         {"20260215", "20260215"},
+		"today":              {"20260301", "20260301"},
+		"yesterday":          {"20260228", "20260228"},
+		"-2d":                {"20260227", "20260227"},
+		"-3d..today":         {"20260226", "20260301"},
+		"20260301..20260220": {"20260220", "20260301"},
+	}
+	for s, want := range cases {
+		from, to, ok := parseDayRange(s, now)
+		if !ok || from.Format("20060102") != want[0] || to.Format("20060102") != want[1] {
+			t.Fatal(s, from, to, ok)
+		}
+	}
+	for _, s := range []string{"app.log", "-xd", "2026021", "today..x", "20261340"} {
+		if _, _, ok := parseDayRange(s, now); ok {
+			t.Fatal("unexpected", s)
+		}
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, ct := range compressTypes {
+		src := filepath.Join(dir, "app_20240102.1.log")
+		if err := os.WriteFile(src, []byte("line 1\nline 2\n"), 0640); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(src, mtime, mtime)
+		dst := src + string(ct)
+		if err := compressFile(src, dst, ct); err != nil {
+			t.Fatal(ct, err)
+		}
+		if tools.FileExists(src) {
+			t.Fatal(ct, "source not removed")
+		}
+		info, err := os.Stat(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 || !info.ModTime().Equal(mtime) {
+			t.Fatal(ct, info.Mode(), info.ModTime())
+		}
+		var out strings.Builder
+		if err = catFiles(&out, []string{dst}); err != nil || out.String() != "line 1\nline 2\n" {
+			t.Fatalf("%s %q %v", ct, out.String(), err)
+		}
+	}
+	if err := compressFile(filepath.Join(dir, "missing.log"), filepath.Join(dir, "missing.log.gz"), CT_GZ); err == nil {
+		t.Fatal("expect error")
+	}
+	if list, _ := filepath.Glob(filepath.Join(dir, "*.tmp-*")); len(list) != 0 {
+		t.Fatal("temp file left", list)
+	}
+}
+
+// captureStdout 执行 fn 并返回写入标准输出的内容
+func captureStdout(t *testing.T, fn func()) string {
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	old := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = old }()
+	fn()
+	return readFile(t, f.Name())
+}
+
+func TestLogCmdDefaultLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	var b strings.Builder
+	for i := 1; i <= 20; i++ {
+		b.WriteString("line " + strconv.Itoa(i) + "\n")
+	}
+	os.WriteFile(path, []byte(b.String()), 0644)
+
+	if err := logCmd.Flags().Parse([]string{path, "--follow=false"}); err != nil {
+		t.Fatal(err)
+	}
+	out := captureStdout(t, func() {
+		if err := logCmd.RunE(logCmd, logCmd.Flags().Args()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if n := strings.Count(out, "\n"); n != 10 || !strings.HasPrefix(out, "line 11\n") {
+		t.Fatalf("got %d lines %q", n, out)
+	}
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+var (
+	watchdogMu sync.Mutex
+	// watchdogDone 每次启动 watchdog 时创建,停止时关闭
+	watchdogDone chan struct{}
+)
+
+// sdNotify 向 $NOTIFY_SOCKET 发送状态,未由 systemd 启动时忽略
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return nil
+	}
+	// @ 开头为抽象命名空间
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// NotifyStatus 更新 systemd 中显示的服务状态
+func NotifyStatus(status string) {
+	if err := sdNotify("STATUS=" + status); err != nil {
+		logger.Debugln("sd_notify", err)
+	}
+}
+
+// WithNotify 由 systemd 启动时,Ready() 通知 systemd 服务已就绪
+// 不再自动就绪,主函数需要在服务可用后调用 Ready()
+func WithNotify() Option {
+	return func(opt *cmdOpt) {
+		opt.notify = true
+	}
+}
+
+// WithWatchdog 开启 systemd watchdog,每 interval/2 调用 check,成功时发送心跳
+// check 为 nil 时只要进程存活就发送心跳,与 WithNotify 相同需要主函数调用 Ready()
+func WithWatchdog(interval time.Duration, check func() error) Option {
+	return func(opt *cmdOpt) {
+		opt.notify = true
+		opt.watchdog = interval
+		opt.watchdogCheck = check
+	}
+}
+
+// notifyReady 通知 systemd 已就绪,平滑升级后由新进程作为主进程
+func notifyReady() {
+	err := sdNotify(fmt.Sprintf("READY=1\nMAINPID=%d\nSTATUS=running", os.Getpid()))
+	if err != nil {
+		logger.Warnln("sd_notify ready", err)
+	}
+	startWatchdog()
+}
+
+// notifyStopping 通知 systemd 正在退出
+func notifyStopping() {
+	stopWatchdog()
+	sdNotify("STOPPING=1\nSTATUS=shutting down")
+}
+
+// watchdogInterval 心跳间隔,优先使用 systemd 设置的 WATCHDOG_USEC
+func watchdogInterval() time.Duration {
+	if usec := os.Getenv("WATCHDOG_USEC"); usec != "" {
+		pid := os.Getenv("WATCHDOG_PID")
+		if pid == "" || pid == strconv.Itoa(os.Getpid()) {
+			return time.Duration(tools.AtoI64(usec)) * time.Microsecond / 2
+		}
+	}
+	if defOpt.watchdog > 0 && os.Getenv("NOTIFY_SOCKET") != "" {
+		return defOpt.watchdog / 2
+	}
+	return 0
+}
+
+func startWatchdog() {
+	interval := watchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	watchdogMu.Lock()
+	defer watchdogMu.Unlock()
+	if watchdogDone != nil {
+		return
+	}
+	done := make(chan struct{})
+	watchdogDone = done
+	go func() {
+		defer OnPanic(nil)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := checkAlive(); err != nil {
+					logger.Warnln("watchdog check failed", err)
+					NotifyStatus("watchdog check failed: " + err.Error())
+					continue
+				}
+				sdNotify("WATCHDOG=1")
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+func stopWatchdog() {
+	watchdogMu.Lock()
+	defer watchdogMu.Unlock()
+	if watchdogDone != nil {
+		close(watchdogDone)
+		watchdogDone = nil
+	}
+}
+
+func checkAlive() (err error) {
+	if defOpt.watchdogCheck == nil {
+		return nil
+	}
+	defer OnPanic(func(a any, s string) {
+		err = fmt.Errorf("panic: %v", a)
+	})
+	return defOpt.watchdogCheck()
+}
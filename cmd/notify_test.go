@@ -0,0 +1,102 @@
+//go:build linux
+
+package cmd
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listenNotify 创建本地 datagram socket 模拟 systemd
+func listenNotify(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func readNotify(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestSdNotify(t *testing.T) {
+	conn := listenNotify(t)
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readNotify(t, conn); msg != "READY=1" {
+		t.Fatalf("got %q", msg)
+	}
+
+	NotifyStatus("loading")
+	if msg := readNotify(t, conn); msg != "STATUS=loading" {
+		t.Fatalf("got %q", msg)
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Fatal("expect no-op without NOTIFY_SOCKET", err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	var fail int32
+	defOpt.watchdogCheck = func() error {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+	defer func() { defOpt.watchdogCheck = nil }()
+
+	if d := watchdogInterval(); d != 50*time.Millisecond {
+		t.Fatalf("interval %v", d)
+	}
+	startWatchdog()
+	defer stopWatchdog()
+
+	if msg := readNotify(t, conn); msg != "WATCHDOG=1" {
+		t.Fatalf("got %q", msg)
+	}
+	// 检查失败时不发送心跳,只更新状态
+	atomic.StoreInt32(&fail, 1)
+	for {
+		msg := readNotify(t, conn)
+		if strings.HasPrefix(msg, "STATUS=watchdog check failed") {
+			break
+		}
+		if msg != "WATCHDOG=1" {
+			t.Fatalf("got %q", msg)
+		}
+	}
+	if msg := readNotify(t, conn); msg == "WATCHDOG=1" {
+		t.Fatal("heartbeat sent after check failed")
+	}
+
+	// 停止后可以重新启动
+	stopWatchdog()
+	time.Sleep(100 * time.Millisecond)
+	atomic.StoreInt32(&fail, 0)
+	startWatchdog()
+	for readNotify(t, conn) != "WATCHDOG=1" {
+	}
+}
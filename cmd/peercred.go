@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package cmd
+
+import (
+	"net"
+)
+
+// peerCredSupported 当前平台不支持获取对端凭证,只允许调用 noCredIPC 中的命令
+const peerCredSupported = false
+
+func peerCred(_ net.Conn) *IPCCred {
+	return nil
+}
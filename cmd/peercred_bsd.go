@@ -0,0 +1,48 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package cmd
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredSupported 获取凭证失败时拒绝 IPC 请求
+const peerCredSupported = true
+
+// peerCred 通过 LOCAL_PEERCRED 获取对端进程的凭证,Groups[0] 为有效组
+func peerCred(conn net.Conn) *IPCCred {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var cred *unix.Xucred
+	var pid int
+	raw.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+		pid = peerPid(int(fd))
+	})
+	if err != nil || cred == nil || cred.Ngroups <= 0 {
+		return nil
+	}
+	n := int(cred.Ngroups)
+	if n > len(cred.Groups) {
+		n = len(cred.Groups)
+	}
+	groups := make([]int, 0, n)
+	for _, g := range cred.Groups[:n] {
+		groups = append(groups, int(g))
+	}
+	return &IPCCred{
+		Pid:    pid,
+		Uid:    int(cred.Uid),
+		Gid:    groups[0],
+		Groups: groups,
+	}
+}
@@ -0,0 +1,12 @@
+package cmd
+
+import "golang.org/x/sys/unix"
+
+// peerPid 通过 LOCAL_PEERPID 获取对端 pid
+func peerPid(fd int) int {
+	pid, err := unix.GetsockoptInt(fd, unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	if err != nil {
+		return 0
+	}
+	return pid
+}
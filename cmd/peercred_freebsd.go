@@ -0,0 +1,6 @@
+package cmd
+
+// peerPid freebsd 的 xucred 不一定包含 pid,未知时为 0
+func peerPid(fd int) int {
+	return 0
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/zhiyin2021/zycli/tools"
+	"golang.org/x/sys/unix"
+)
+
+// peerCredSupported 获取凭证失败时拒绝 IPC 请求
+const peerCredSupported = true
+
+// peerCred 通过 SO_PEERCRED 获取对端进程的凭证
+func peerCred(conn net.Conn) *IPCCred {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var cred *unix.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return nil
+	}
+	return &IPCCred{
+		Pid:    int(cred.Pid),
+		Uid:    int(cred.Uid),
+		Gid:    int(cred.Gid),
+		Groups: procGroups(int(cred.Pid)),
+	}
+}
+
+// procGroups 读取 /proc/<pid>/status 中的附加组
+func procGroups(pid int) []int {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Groups:") {
+			continue
+		}
+		var gids []int
+		for _, s := range strings.Fields(line[len("Groups:"):]) {
+			gids = append(gids, tools.AtoI(s))
+		}
+		return gids
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// 支持的性能分析类型及默认采样时长
+var pprofProfiles = []struct {
+	name     string
+	duration time.Duration
+	usage    string
+}{
+	{"cpu", 30 * time.Second, "cpu profile"},
+	{"heap", 0, "memory allocations of live objects"},
+	{"allocs", 0, "all past memory allocations"},
+	{"goroutine", 0, "stack traces of all current goroutines"},
+	{"threadcreate", 0, "stack traces that led to new OS threads"},
+	{"mutex", 10 * time.Second, "stack traces of holders of contended mutexes"},
+	{"block", 10 * time.Second, "stack traces that led to blocking on synchronization"},
+	{"trace", 5 * time.Second, "execution trace"},
+}
+
+// blockProfileRate 当前的 block 采样率,runtime 不提供读取接口,-1 表示 pprof 临时开启
+var blockProfileRate int64
+
+// mutexSampling pprof mutex 采样中,同一时间只允许一次临时采样
+var mutexSampling int32
+
+// SetBlockProfileRate 开启 block 采样,代替 runtime.SetBlockProfileRate 以便 pprof block 判断是否已开启
+func SetBlockProfileRate(rate int) {
+	atomic.StoreInt64(&blockProfileRate, int64(rate))
+	runtime.SetBlockProfileRate(rate)
+}
+
+// writeProfile 采集性能数据写入 w
+func writeProfile(w io.Writer, name string, duration time.Duration, debug int) error {
+	switch name {
+	case "cpu":
+		if err := pprof.StartCPUProfile(w); err != nil {
+			return err
+		}
+		time.Sleep(duration)
+		pprof.StopCPUProfile()
+		return nil
+	case "trace":
+		if err := trace.Start(w); err != nil {
+			return err
+		}
+		time.Sleep(duration)
+		trace.Stop()
+		return nil
+	case "mutex":
+		if duration <= 0 {
+			break
+		}
+		if !atomic.CompareAndSwapInt32(&mutexSampling, 0, 1) {
+			return errors.New("mutex sampling already in progress")
+		}
+		defer atomic.StoreInt32(&mutexSampling, 0)
+		// 未开启采样时,临时开启 duration 时长
+		if runtime.SetMutexProfileFraction(-1) == 0 {
+			runtime.SetMutexProfileFraction(5)
+			time.Sleep(duration)
+			defer runtime.SetMutexProfileFraction(0)
+		}
+	case "block":
+		if duration > 0 && atomic.LoadInt64(&blockProfileRate) == -1 {
+			return errors.New("block sampling already in progress")
+		}
+		// 未开启采样时,临时开启 duration 时长
+		if duration > 0 && atomic.CompareAndSwapInt64(&blockProfileRate, 0, -1) {
+			runtime.SetBlockProfileRate(1)
+			time.Sleep(duration)
+			defer func() {
+				// 期间调用过 SetBlockProfileRate 时保留新的设置
+				if atomic.CompareAndSwapInt64(&blockProfileRate, -1, 0) {
+					runtime.SetBlockProfileRate(0)
+				}
+			}()
+		}
+	}
+	p := pprof.Lookup(name)
+	if p == nil {
+		return NewIPCError(IPC_BAD_REQUEST, "unknown profile "+name)
+	}
+	return p.WriteTo(w, debug)
+}
+
+var pprofCmd = &cobra.Command{
+	Use:   "pprof",
+	Short: "pprof <type>",
+	Long:  `collect runtime/pprof profile from running service`,
+}
+
+func newPprofCmd(name string, duration time.Duration, usage string) *cobra.Command {
+	var (
+		output string
+		debug  int
+	)
+	c := &cobra.Command{
+		Use:   name,
+		Short: usage,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := io.Writer(os.Stdout)
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			resp, err := CallIPCStream("pprof", map[string]string{
+				"name":     name,
+				"duration": duration.String(),
+				"debug":    fmt.Sprint(debug),
+			}, w, duration+defOpt.ipcTimeout)
+			if err == nil {
+				err = resp.Err()
+			}
+			if err != nil {
+				if output != "-" {
+					os.Remove(output)
+				}
+				return err
+			}
+			if output != "-" {
+				fmt.Println("profile saved to", output)
+			}
+			return nil
+		},
+	}
+	c.SilenceUsage = true
+	c.Flags().StringVarP(&output, "output", "o", name+".pprof", "output file, - for stdout")
+	c.Flags().IntVar(&debug, "debug", 0, "debug level, 0 for binary format")
+	if duration > 0 {
+		c.Flags().DurationVarP(&duration, "duration", "d", duration, "sampling duration")
+	}
+	return c
+}
+
+func init() {
+	RegisterIPC("pprof", IPCHandler{
+		Short: "collect runtime/pprof profile",
+		Args: []IPCArg{
+			{Name: "name", Type: ARG_STRING, Default: "heap", Usage: "profile type"},
+			{Name: "duration", Type: ARG_DURATION, Default: "0s", Usage: "sampling duration"},
+			{Name: "debug", Type: ARG_INT, Default: "0", Usage: "debug level"},
+		},
+		Handle: func(req *IPCRequest) (any, error) {
+			name := req.String("name")
+			if name != "cpu" && name != "trace" && pprof.Lookup(name) == nil {
+				return nil, NewIPCError(IPC_BAD_REQUEST, "unknown profile "+name)
+			}
+			return IPCStream(func(w io.Writer) error {
+				return writeProfile(w, name, req.Duration("duration"), req.Int("debug"))
+			}), nil
+		},
+	})
+	for _, p := range pprofProfiles {
+		pprofCmd.AddCommand(newPprofCmd(p.name, p.duration, p.usage))
+	}
+	RootCmd.AddCommand(pprofCmd)
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPprofSamplingBusy(t *testing.T) {
+	for _, name := range []string{"mutex", "block"} {
+		done := make(chan error, 1)
+		go func() {
+			done <- writeProfile(io.Discard, name, 200*time.Millisecond, 0)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if err := writeProfile(io.Discard, name, time.Second, 0); err == nil {
+			t.Fatal(name, "expect busy error")
+		}
+		if err := <-done; err != nil {
+			t.Fatal(name, err)
+		}
+		// 采样结束后可以再次采样
+		if err := writeProfile(io.Discard, name, 10*time.Millisecond, 0); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+}
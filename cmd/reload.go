@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+type reloadTarget struct {
+	name string
+	fn   func() error
+}
+
+type configTarget struct {
+	name string
+	get  func() any
+}
+
+var (
+	reloadMu      sync.Mutex
+	reloadTargets []reloadTarget
+	configTargets []configTarget
+)
+
+// 配置中需要隐藏的字段名,比较时忽略大小写和 _ -
+var secretKeys = []string{"password", "passwd", "pwd", "secret", "token", "apikey", "accesskey", "privatekey", "credential", "connstr", "dsn"}
+
+// isSecretKey 字段名是否包含敏感信息
+func isSecretKey(key string) bool {
+	key = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactConfig 将配置转为 json 结构并隐藏敏感字段
+func redactConfig(cfg any) (any, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err = json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return redactValue(v), nil
+}
+
+func redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			// 敏感字段无论是否为数组或对象都整体隐藏,只保留 null
+			if isSecretKey(k) && val != nil {
+				t[k] = "******"
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+	case []any:
+		for i := range t {
+			t[i] = redactValue(t[i])
+		}
+	}
+	return v
+}
+
+// OnReload 注册重载回调,收到 SIGHUP 或执行 reload 命令时按注册顺序调用
+func OnReload(name string, fn func() error) {
+	if fn == nil {
+		return
+	}
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadTargets = append(reloadTargets, reloadTarget{name: name, fn: fn})
+}
+
+// RegisterConfig 解析配置文件并注册为重载目标
+// 重载时使用 tools.LoadConfig 重新解析,成功后调用 onReload(旧配置, 新配置),失败时保留旧配置
+func RegisterConfig[T any](filename string, unmarshal func([]byte, any) error, onReload func(old, new T)) (T, error) {
+	var mu sync.Mutex
+	// 实例优先使用 name@instance.ext 配置文件
+	if f := instanceFile(filename); tools.FileExists(f) || tools.FileExists(tools.CurrentDir()+f) {
+		filename = f
+	}
+	cfg, err := tools.LoadConfig[T](filename, unmarshal)
+	cur := cfg
+	reloadMu.Lock()
+	configTargets = append(configTargets, configTarget{name: filename, get: func() any {
+		mu.Lock()
+		defer mu.Unlock()
+		return cur
+	}})
+	reloadMu.Unlock()
+	OnReload(filename, func() error {
+		next, err := tools.LoadConfig[T](filename, unmarshal)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		old := cur
+		cur = next
+		mu.Unlock()
+		if onReload != nil {
+			onReload(old, next)
+		}
+		return nil
+	})
+	return cfg, err
+}
+
+// Reload 重新加载所有已注册的配置并切割当前日志文件
+func Reload() error {
+	reloadMu.Lock()
+	list := make([]reloadTarget, len(reloadTargets))
+	copy(list, reloadTargets)
+	reloadMu.Unlock()
+
+	var errs []string
+	for _, t := range list {
+		if err := callReload(t); err != nil {
+			logger.Errorw("reload failed", "name", t.name, "err", err)
+			errs = append(errs, t.name+": "+err.Error())
+		} else {
+			logger.Infow("reload done", "name", t.name)
+		}
+	}
+	if activeLog != nil {
+		if err := activeLog.Rotate(); err != nil {
+			logger.Errorw("reload rotate log failed", "err", err)
+			errs = append(errs, "log: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func callReload(t reloadTarget) (err error) {
+	defer OnPanic(func(a any, s string) {
+		err = errors.New("panic in reload callback")
+	})
+	return t.fn()
+}
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "reload",
+	Long:  `reload config and reopen log file`,
+	Run: func(cmd *cobra.Command, args []string) {
+		callIPCLog("reload")
+	},
+}
+
+// currentConfigs 返回已注册的当前配置,敏感字段已隐藏
+func currentConfigs() (map[string]any, error) {
+	reloadMu.Lock()
+	list := make([]configTarget, len(configTargets))
+	copy(list, configTargets)
+	reloadMu.Unlock()
+
+	m := make(map[string]any, len(list))
+	for _, c := range list {
+		v, err := redactConfig(c.get())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		m[c.name] = v
+	}
+	return m, nil
+}
+
+func init() {
+	RegisterIPC("config", IPCHandler{
+		Short: "show effective config, secrets are redacted",
+		Handle: func(req *IPCRequest) (any, error) {
+			return currentConfigs()
+		},
+	})
+	RootCmd.AddCommand(reloadCmd)
+}
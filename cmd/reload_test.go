@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactConfig(t *testing.T) {
+	type db struct {
+		DSN  string `json:"dsn"`
+		Host string `json:"host"`
+	}
+	cfg := struct {
+		Port     int               `json:"port"`
+		Password string            `json:"password"`
+		DB       []db              `json:"db"`
+		Extra    map[string]string `json:"extra"`
+		Auth     map[string]any    `json:"auth"`
+		APIKeys  []string          `json:"apiKeys"`
+	}{
+		Port:     80,
+		Password: "p",
+		DB:       []db{{DSN: "root:p@/x", Host: "h"}},
+		Extra:    map[string]string{"api_token": "t", "Access-Key": "k", "name": "n", "secret": ""},
+		Auth:     map[string]any{"db_password": 1234, "token": true, "secret_key": nil, "credential": map[string]any{"user": "u"}, "secret": map[string]any{"value": "x"}},
+		APIKeys:  []string{"k1", "k2"},
+	}
+	v, err := redactConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(v)
+	want := `{"apiKeys":"******","auth":{"credential":"******","db_password":"******","secret":"******","secret_key":null,"token":"******"},"db":[{"dsn":"******","host":"h"}],"extra":{"Access-Key":"******","api_token":"******","name":"n","secret":"******"},"password":"******","port":80}`
+	if string(data) != want {
+		t.Fatal(string(data))
+	}
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"os/signal"
 	"runtime/debug"
 	"sync"
@@ -25,7 +27,27 @@ type cmdOpt struct {
 	maxAge       int
 	maxCount     int
 	compressType CompressType
+	rotation     LogRotation
 	layout       string
+	// 退出相关
+	shutdownTimeout time.Duration
+	// IPC 请求超时
+	ipcTimeout time.Duration
+	// IPC socket 权限和所属用户/组,-1 表示不修改
+	ipcMode os.FileMode
+	ipcUid  int
+	ipcGid  int
+	// 平滑升级
+	upgradeTimeout time.Duration
+	manualReady    bool
+	// systemd unit 配置
+	unit UnitOptions
+	// sd_notify 和 watchdog
+	notify        bool
+	watchdog      time.Duration
+	watchdogCheck func() error
+	// 主函数 panic 后进程内重启
+	supervisor *SupervisorPolicy
 }
 
 type Option func(*cmdOpt)
@@ -34,7 +56,9 @@ var (
 	Version   = "0.0.1"
 	DEBUG     = false
 	svcFunc   func([]string)
+	panicFile *os.File
 	quit, sig = make(chan os.Signal), make(chan os.Signal, 1)
+	quitOnce  sync.Once
 	defOpt    = &cmdOpt{
 		regSvc:       false,
 		logPath:      tools.CurrentDir() + "/log/",
@@ -44,7 +68,16 @@ var (
 		maxCount:     0,
 		logToFile:    false,
 		compressType: CT_GZ,
+		rotation:     defLogRotation(),
 		layout:       "060102_150405_000",
+
+		shutdownTimeout: 30 * time.Second,
+		ipcTimeout:      5 * time.Second,
+		ipcMode:         0600,
+		ipcUid:          -1,
+		ipcGid:          -1,
+		upgradeTimeout:  30 * time.Second,
+		unit:            defUnitOptions(),
 	}
 )
 var RootCmd = &cobra.Command{
@@ -53,17 +86,25 @@ var RootCmd = &cobra.Command{
 	Long:    tools.CurrentName() + ` server.`,
 	Version: Version,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("--------------------\n  app: %s \n  ver: %s \n--------------------\n", tools.CurrentName(), Version)
+		fmt.Printf("--------------------\n  app: %s \n  ver: %s \n--------------------\n", svcName(), Version)
 		if svcFunc != nil {
+			// 只有服务进程把 panic 输出重定向到文件,命令行错误仍输出到终端
+			panicFile = redirectPanic()
 			if !DEBUG {
-				DEBUG = tools.FileExists(tools.CurrentName() + ".dbg")
+				DEBUG = tools.FileExists(svcName() + ".dbg")
+			}
+			if DEBUG {
+				logger.SetLevel(zapcore.DebugLevel)
 			}
-			if IsRuning() {
-				fmt.Println("already running")
+			if err := acquireLock(); err != nil {
+				fmt.Println(err)
+				setExitCode(EXIT_ERROR)
 				return
 			}
+			defer releaseLock()
 			err := startUnixSock()
 			if err != nil {
+				setExitCode(EXIT_ERROR)
 				return
 			}
 			defer stopUnixSock()
@@ -71,26 +112,45 @@ var RootCmd = &cobra.Command{
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				defer OnPanic(func(a any, s string) {
-					sig <- syscall.SIGTERM
-				})
 				defer wg.Done()
-				svcFunc(args)
+				// 主函数 panic 时不能通知就绪,否则平滑升级的父进程会退出
+				if runMain(args) && defOpt.autoReady() {
+					Ready()
+				}
 			}()
 
-			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-			s := <-sig
-			select {
-			case quit <- s:
-				logger.Println("wait quit")
-				wg.Wait()
-			case <-time.After(10 * time.Millisecond):
-				logger.Println("system quit")
-			}
+			s := waitSignal()
+			logger.Println("wait quit", s)
+			closeQuit()
+			code := shutdown(&wg)
+			logger.Println("system quit", code)
 		}
 	},
 }
 
+// waitSignal 等待退出信号,期间处理重载和平滑升级信号
+func waitSignal() os.Signal {
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP}
+	if sigUpgrade != nil {
+		signals = append(signals, sigUpgrade)
+	}
+	signal.Notify(sig, signals...)
+	for {
+		s := <-sig
+		logger.Println("receive signal", s)
+		switch s {
+		case syscall.SIGHUP:
+			Reload()
+		case sigUpgrade:
+			if _, err := upgrade(defOpt.upgradeTimeout); err == nil {
+				return syscall.SIGTERM
+			}
+		default:
+			return s
+		}
+	}
+}
+
 func WithLogPath(path string) Option {
 	return func(opt *cmdOpt) {
 		opt.logPath = path
@@ -109,6 +169,49 @@ func WithIpcPath(ipcPath string) Option {
 		opt.ipcPath = ipcPath
 	}
 }
+
+// IPC 请求超时时间,默认:5s
+func WithIpcTimeout(timeout time.Duration) Option {
+	return func(opt *cmdOpt) {
+		opt.ipcTimeout = timeout
+	}
+}
+
+// IPC socket 文件权限,默认:0600
+func WithIpcPerm(mode os.FileMode) Option {
+	return func(opt *cmdOpt) {
+		opt.ipcMode = mode
+	}
+}
+
+// IPC socket 文件所属用户和组,-1 表示不修改
+// 未声明 Uids/Gids 的命令同时允许该用户调用
+func WithIpcOwner(uid, gid int) Option {
+	return func(opt *cmdOpt) {
+		opt.ipcUid = uid
+		opt.ipcGid = gid
+	}
+}
+
+// 平滑升级等待新进程就绪的超时时间,默认:30s
+func WithUpgradeTimeout(timeout time.Duration) Option {
+	return func(opt *cmdOpt) {
+		opt.upgradeTimeout = timeout
+	}
+}
+
+// 主函数需要自行调用 Ready() 通知就绪,默认主函数正常返回后自动就绪
+// 使用 WithNotify/WithWatchdog 时同样需要自行调用
+func WithManualReady() Option {
+	return func(opt *cmdOpt) {
+		opt.manualReady = true
+	}
+}
+
+// autoReady 是否自动通知就绪,systemd 通知需要主函数确认服务可用
+func (opt *cmdOpt) autoReady() bool {
+	return !opt.manualReady && !opt.notify
+}
 func WithLogMaxSize(maxSize int64) Option {
 	return func(opt *cmdOpt) {
 		opt.maxSize = maxSize
@@ -124,6 +227,13 @@ func WithLogMaxCount(maxCount int) Option {
 		opt.maxCount = maxCount
 	}
 }
+
+// WithLogRotation 日志切割策略,默认每天零点或超过 WithLogMaxSize 时切割,零值使用默认策略
+func WithLogRotation(rotation LogRotation) Option {
+	return func(opt *cmdOpt) {
+		opt.rotation = rotation.orDefault()
+	}
+}
 func WithLogCompressType(compressType CompressType) Option {
 	return func(opt *cmdOpt) {
 		opt.compressType = compressType
@@ -134,11 +244,32 @@ func WithLogLayout(layout string) Option {
 		opt.layout = layout
 	}
 }
+
+// 退出钩子全局超时时间,默认:30s
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(opt *cmdOpt) {
+		opt.shutdownTimeout = timeout
+	}
+}
+
+// WaitQuit 返回的 channel 在收到退出信号时关闭,可以被多个协程同时等待
 func WaitQuit() <-chan os.Signal {
 	return quit
 }
+
+// closeQuit 通知所有 WaitQuit() 的等待方退出
+func closeQuit() {
+	quitOnce.Do(func() {
+		close(quit)
+	})
+}
+
+// Quit 通知服务退出,可重复调用,已有待处理的信号时不阻塞
 func Quit() {
-	sig <- syscall.SIGQUIT
+	select {
+	case sig <- syscall.SIGQUIT:
+	default:
+	}
 }
 
 // mainFunc 主函数
@@ -158,18 +289,28 @@ func Execute(mainFunc func([]string), opts ...Option) {
 		defOpt.logPath = tools.CurrentDir() + "/log/"
 	}
 	svcFunc = mainFunc
+	addIPCCmds()
 	if defOpt.regSvc {
 		addSvc()
 	}
-	if defOpt.logToFile {
-		defOpt.initLog()
+	code := EXIT_OK
+	// 错误已由 cobra 输出
+	if err := RootCmd.Execute(); err != nil {
+		code = EXIT_ERROR
+		// 透传 systemctl 等子命令的退出码
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			code = exitErr.ExitCode()
+		}
+	} else {
+		code = ExitCode()
 	}
-	if f := redirectPanic(); f != nil {
-		defer f.Close()
+	logger.Sync()
+	if panicFile != nil {
+		panicFile.Close()
 	}
-	if err := RootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, "root.execute:"+err.Error())
-		os.Exit(1)
+	if code != EXIT_OK {
+		os.Exit(code)
 	}
 }
 
@@ -178,18 +319,37 @@ var dbgCmd = &cobra.Command{
 	Short: "dbg",
 	Long:  `enabled debug`,
 	Run: func(cmd *cobra.Command, args []string) {
-		msg, err := SendMsgToIPC("dbg")
-		if err != nil {
-			if err.Error() != "EOF" {
-				logger.Errorln("please check application not running:", err)
-			}
-		} else {
-			logger.Infoln(msg)
-		}
+		callIPCLog("dbg")
 	},
 }
 
+// callIPCLog 调用无参数的 IPC 命令并输出结果
+func callIPCLog(name string) {
+	resp, err := CallIPC(name, nil)
+	if err != nil {
+		logger.Errorln("please check application not running:", err)
+	} else if err = resp.Err(); err != nil {
+		logger.Errorln(name, err)
+	} else {
+		logger.Infoln(resp.Text())
+	}
+}
+
+// initOpt 解析命令行参数后确定实例,IPC 路径并初始化日志
+func initOpt() {
+	// 此时还未执行任何命令,参数错误直接退出
+	if err := resolveInstance(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+	resolveIpcPath()
+	if defOpt.logToFile {
+		defOpt.initLog()
+	}
+}
+
 func init() {
+	cobra.OnInitialize(initOpt)
 	RootCmd.PersistentFlags().BoolVar(&DEBUG, "debug", false, "start with debug mode")
 	RootCmd.AddCommand(dbgCmd)
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunMainReady(t *testing.T) {
+	old := svcFunc
+	defer func() {
+		svcFunc = old
+		atomic.StoreInt32(&exitCode, EXIT_OK)
+	}()
+	svcFunc = func([]string) {}
+	if !runMain(nil) {
+		t.Fatal("expect ok")
+	}
+	svcFunc = func([]string) { panic("boom") }
+	if runMain(nil) {
+		t.Fatal("expect not ok after panic")
+	}
+	if s := <-sig; s == nil || ExitCode() != EXIT_PANIC {
+		t.Fatal(s, ExitCode())
+	}
+
+	opt := &cmdOpt{}
+	if !opt.autoReady() {
+		t.Fatal("expect auto ready")
+	}
+	WithNotify()(opt)
+	if opt.autoReady() {
+		t.Fatal("notify requires explicit Ready")
+	}
+}
+
+func TestQuitNonBlocking(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		Quit()
+		Quit()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Quit blocked")
+	}
+	if s := <-sig; s != syscall.SIGQUIT {
+		t.Fatal(s)
+	}
+}
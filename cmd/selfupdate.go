@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// 自更新参数
+var updateFlags = struct {
+	from, sha256 string
+	timeout      time.Duration
+}{}
+
+// isURL 是否为 http(s) 地址
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// openSource 打开本地文件或下载地址
+func openSource(from string) (io.ReadCloser, error) {
+	if !isURL(from) {
+		return os.Open(from)
+	}
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(from)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download %s: %s", from, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// fetchSha256 读取 <from>.sha256 校验文件,格式与 sha256sum 输出相同
+func fetchSha256(from string) (string, error) {
+	r, err := openSource(from + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, 1024))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum file %s.sha256", from)
+	}
+	return fields[0], nil
+}
+
+// fetchBinary 下载或复制新程序到 exe 同目录的临时文件并校验 sha256,返回临时文件路径
+// sum 为空时读取 <from>.sha256,同源的校验文件只能发现传输损坏,不能防止篡改
+// http 地址可以被中间人同时替换程序和校验文件,必须指定 sum
+func fetchBinary(from, sum, exe string) (string, error) {
+	if sum == "" {
+		if strings.HasPrefix(from, "http://") {
+			return "", errors.New("--sha256 is required for http:// source")
+		}
+		var err error
+		if sum, err = fetchSha256(from); err != nil {
+			return "", fmt.Errorf("--sha256 not set and read checksum file failed: %w", err)
+		}
+	}
+	r, err := openSource(from)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	// 与 exe 同目录,保证 rename 是原子操作
+	f, err := os.CreateTemp(filepath.Dir(exe), filepath.Base(exe)+".new-*")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, strings.TrimSpace(sum)) {
+			err = fmt.Errorf("sha256 mismatch, expect %s got %s", sum, got)
+		}
+	}
+	if err == nil {
+		mode := os.FileMode(0755)
+		if st, e := os.Stat(exe); e == nil {
+			mode = st.Mode().Perm()
+		}
+		err = os.Chmod(f.Name(), mode)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// checkBinary 执行 --version 确认新程序可以运行
+func checkBinary(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("new binary check failed: %w %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// replaceBinary 将当前程序备份为 .bak 后用新程序原子替换
+func replaceBinary(exe, tmp string) error {
+	bak := exe + ".bak"
+	os.Remove(bak)
+	if err := os.Link(exe, bak); err != nil {
+		if err = copyFile(exe, bak); err != nil {
+			return fmt.Errorf("backup %s: %w", exe, err)
+		}
+	}
+	return os.Rename(tmp, exe)
+}
+
+// rollbackBinary 使用 .bak 恢复程序
+func rollbackBinary(exe string) error {
+	bak := exe + ".bak"
+	if !tools.FileExists(bak) {
+		return fmt.Errorf("backup %s not found", bak)
+	}
+	tmp := exe + ".rollback"
+	if err := copyFile(bak, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, exe)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, st.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// restartService 使用新程序重启服务并等待 IPC 响应
+// 已通过 init 系统安装时由其重启,否则通过 IPC 平滑升级
+func restartService(timeout time.Duration) error {
+	if s, err := initSystem(); err == nil && tools.FileExists(s.Path(svcName())) {
+		svcTimeout = timeout
+		return ctlSvc(s, "restart")
+	}
+	old, ok := runningPid()
+	if !ok {
+		return errors.New("not running")
+	}
+	msg, err := ipcUpgrade(timeout)
+	if err != nil {
+		return err
+	}
+	fmt.Println(msg)
+	// 旧进程退出前仍会响应 IPC
+	if !waitExit(old, timeout) {
+		return fmt.Errorf("wait process %d exit timeout", old)
+	}
+	return waitIPC(timeout, nil)
+}
+
+// selfUpdate 下载校验新程序并替换,服务运行时重启,新程序未响应 IPC 时回滚
+func selfUpdate(from, sum string, timeout time.Duration) error {
+	exe := filepath.Join(tools.CurrentDir(), tools.CurrentName())
+	tmp, err := fetchBinary(from, sum, exe)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if err = checkBinary(tmp); err != nil {
+		return err
+	}
+	_, running := runningPid()
+	if err = replaceBinary(exe, tmp); err != nil {
+		return err
+	}
+	fmt.Println("replace", exe, "backup", exe+".bak")
+	if !running {
+		return nil
+	}
+	if err = restartService(timeout); err == nil {
+		return nil
+	}
+	fmt.Println("upgrade failed, rollback:", err)
+	if e := rollbackBinary(exe); e != nil {
+		return fmt.Errorf("upgrade failed: %v, rollback failed: %w", err, e)
+	}
+	// 平滑升级失败时旧进程仍在运行,否则使用旧程序重启
+	if waitIPC(time.Second, nil) != nil {
+		if e := restartService(timeout); e != nil {
+			return fmt.Errorf("upgrade failed: %v, restart after rollback failed: %w", err, e)
+		}
+	}
+	return fmt.Errorf("upgrade failed and rolled back: %w", err)
+}
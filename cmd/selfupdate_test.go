@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newReleaseServer 模拟发布服务器,提供 /app 和 /app.sha256
+func newReleaseServer(t *testing.T, data []byte) *httptest.Server {
+	sum := sha256.Sum256(data)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+	mux.HandleFunc("/app.sha256", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(hex.EncodeToString(sum[:]) + "  app\n"))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeExe(t *testing.T, data string) string {
+	exe := filepath.Join(t.TempDir(), "app")
+	if err := os.WriteFile(exe, []byte(data), 0750); err != nil {
+		t.Fatal(err)
+	}
+	return exe
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFetchBinary(t *testing.T) {
+	data := []byte("new binary")
+	srv := newReleaseServer(t, data)
+	exe := writeExe(t, "old binary")
+	sum := sha256.Sum256(data)
+
+	tmp, err := fetchBinary(srv.URL+"/app", hex.EncodeToString(sum[:]), exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, tmp); got != string(data) {
+		t.Fatalf("got %q", got)
+	}
+	if st, _ := os.Stat(tmp); st.Mode().Perm() != 0750 {
+		t.Fatalf("mode %v", st.Mode())
+	}
+	os.Remove(tmp)
+
+	// http 地址必须指定 sha256
+	if _, err = fetchBinary(srv.URL+"/app", "", exe); err == nil {
+		t.Fatal("expect sha256 required")
+	}
+	// 本地文件未指定 sha256 时读取 .sha256 文件
+	src := filepath.Join(t.TempDir(), "app")
+	os.WriteFile(src, data, 0644)
+	os.WriteFile(src+".sha256", []byte(hex.EncodeToString(sum[:])+"  app\n"), 0644)
+	tmp, err = fetchBinary(src, "", exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(tmp)
+
+	if _, err = fetchBinary(srv.URL+"/app", "0000", exe); err == nil {
+		t.Fatal("expect sha256 mismatch")
+	}
+	if _, err = fetchBinary(srv.URL+"/missing", "0000", exe); err == nil {
+		t.Fatal("expect download error")
+	}
+	// 失败时不残留临时文件
+	if list, _ := filepath.Glob(exe + ".new-*"); len(list) != 0 {
+		t.Fatal("temp file left", list)
+	}
+}
+
+func TestReplaceAndRollback(t *testing.T) {
+	exe := writeExe(t, "old binary")
+	tmp := filepath.Join(filepath.Dir(exe), "app.new")
+	if err := os.WriteFile(tmp, []byte("new binary"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceBinary(exe, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, exe); got != "new binary" {
+		t.Fatalf("exe %q", got)
+	}
+	if got := readFile(t, exe+".bak"); got != "old binary" {
+		t.Fatalf("bak %q", got)
+	}
+	if err := rollbackBinary(exe); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, exe); got != "old binary" {
+		t.Fatalf("rollback %q", got)
+	}
+}
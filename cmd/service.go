@@ -1,131 +1,194 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/zhiyin2021/zycli/tools"
-	"github.com/zhiyin2021/zycli/tools/logger"
 )
 
-var (
-	daemoCmd *exec.Cmd
-)
+// svcTimeout 等待服务启动或停止的超时时间
+var svcTimeout time.Duration
 
-// ServerCmd represents the server command
-var svcCmd = &cobra.Command{
-	Use:   "nc",
-	Short: "backgroud service",
-	Long:  `backgroud Service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		daemoCmd = exec.Command(os.Args[0])
-		//异步启动子进程
-		err := daemoCmd.Start()
-		if err != nil {
-			panic(err)
-		}
-		logger.Println("backgroup started => ", daemoCmd.Process.Pid)
-	},
-}
 var installCmd = &cobra.Command{
 	Use:   "install",
 	Short: "install",
-	Long:  `backgroud service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fname := tools.CurrentName()
-		path := tools.CurrentDir()
-		data := fmt.Sprintf(svcText, fname, path, path, fname)
-
-		os.Remove("/usr/sbin/" + fname)
-		os.Symlink(path+"/"+fname, "/usr/sbin/"+fname)
+	Long:  `install as system service (systemd,sysv,openrc,supervisord)`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fname := svcName()
+		s, err := initSystem()
+		if err != nil {
+			return err
+		}
+		data, err := s.Render(fname, unitOptions(cmd))
+		if err != nil {
+			return err
+		}
+		if unitFlags.dryRun {
+			fmt.Printf("# %s\n%s", s.Path(fname), data)
+			return nil
+		}
 
-		err := os.WriteFile("/etc/systemd/system/"+fname+".service", []byte(data), 0644)
-		if err == nil {
-			logger.Println("generate service success")
-			if err = run("systemctl", "daemon-reload"); err == nil {
-				logger.Println("reload service success")
-				ctlSvc("enable")
-				if err = ctlSvc("start"); err == nil {
-					return
-				}
-			}
+		link := binPath()
+		os.MkdirAll(filepath.Dir(link), 0755)
+		os.Remove(link)
+		if err = os.Symlink(filepath.Join(tools.CurrentDir(), tools.CurrentName()), link); err != nil {
+			return err
+		}
+		if err = s.Install(fname, data); err != nil {
+			return fmt.Errorf("install %s service: %w", s.Name(), err)
+		}
+		fmt.Println("install", s.Name(), "service", s.Path(fname))
+		if userMode {
+			fmt.Println("run `loginctl enable-linger` to keep service running after logout")
 		}
-		logger.Println("service install error", err)
+		// 重复安装时使新配置生效
+		return ctlSvc(s, "restart")
 	},
 }
 var uninstallCmd = &cobra.Command{
 	Use:   "uninstall",
 	Short: "uninstall",
 	Long:  `backgroud service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fname := tools.CurrentName()
-		ctlSvc("stop")
-		ctlSvc("disable")
-		os.Remove("/etc/systemd/system/" + fname + ".service")
-		run("systemctl", "daemon-reload")
-		os.Remove("/usr/sbin/" + fname)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := initSystem()
+		if err != nil {
+			return err
+		}
+		if _, ok := runningPid(); ok {
+			if err = ctlSvc(s, "stop"); err != nil {
+				return err
+			}
+		}
+		if err = s.Uninstall(svcName()); err != nil {
+			return fmt.Errorf("uninstall %s service: %w", s.Name(), err)
+		}
+		// 其他实例仍在使用时保留程序链接
+		if instance == "" {
+			os.Remove(binPath())
+		}
+		fmt.Println("uninstall", s.Name(), "service", s.Path(svcName()))
+		return nil
 	},
 }
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "start",
-	Long:  `start service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		ctlSvc("start")
+	Long:  `start service and wait until ipc answers`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return svcAction("start")
 	},
 }
 var restartCmd = &cobra.Command{
 	Use:   "restart",
 	Short: "restart",
-	Long:  `restart service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		ctlSvc("restart")
+	Long:  `restart service and wait until ipc answers`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return svcAction("restart")
 	},
 }
 
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "stop",
-	Long:  `stop service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		ctlSvc("stop")
+	Long:  `stop service and wait until process exits`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return svcAction("stop")
 	},
 }
 
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "status",
-	Long:  `status service`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cc := exec.Command("systemctl", "status", tools.CurrentName()+".service")
+	Long:  `status service, exit code follows init system`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := initSystem()
+		if err != nil {
+			return err
+		}
+		c := s.Command("status", svcName())
+		cc := exec.Command(c[0], c[1:]...)
 		cc.Stdout = os.Stdout
-		//异步启动子进程
-		cc.Run()
+		cc.Stderr = os.Stderr
+		// 状态已由 init 系统输出,只返回退出码
+		cmd.SilenceErrors = true
+		return cc.Run()
 	},
 }
 
+// run 执行命令并等待结束,失败时返回命令输出
 func run(name string, arg ...string) error {
-	daemoCmd := exec.Command(name, arg...)
-	//异步启动子进程
-	return daemoCmd.Start()
+	var out bytes.Buffer
+	c := exec.Command(name, arg...)
+	c.Stdout = &out
+	c.Stderr = &out
+	if err := c.Run(); err != nil {
+		line := strings.Join(append([]string{name}, arg...), " ")
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("%s: %w\n%s", line, err, msg)
+		}
+		return fmt.Errorf("%s: %w", line, err)
+	}
+	return nil
+}
+
+// waitStarted 等待新进程持有 pid 文件锁且 IPC 可以响应
+func waitStarted(old int, timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if pid, ok := runningPid(); ok && pid != old {
+			return pid, waitIPC(time.Until(deadline), nil)
+		}
+		if time.Now().After(deadline) {
+			return 0, errors.New("wait service start timeout")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
 
-func ctlSvc(ctl string) error {
-	err := run("systemctl", ctl, tools.CurrentName()+".service")
-	if err == nil {
-		logger.Println(ctl + " service success")
-	} else {
-		logger.Println(ctl+" service error", err)
+// ctlSvc 执行 start/stop/restart 并确认结果
+func ctlSvc(s InitSystem, ctl string) error {
+	old, _ := runningPid()
+	c := s.Command(ctl, svcName())
+	if err := run(c[0], c[1:]...); err != nil {
+		return err
 	}
-	return err
+	if ctl == "stop" {
+		if old > 0 && !waitExit(old, svcTimeout) {
+			return fmt.Errorf("stop service: wait process %d exit timeout", old)
+		}
+		fmt.Println("stop service success")
+		return nil
+	}
+	// start 时服务已运行则无需等待新进程
+	if ctl == "start" && old > 0 {
+		old = 0
+	}
+	pid, err := waitStarted(old, svcTimeout)
+	if err != nil {
+		return fmt.Errorf("%s service: %w", ctl, err)
+	}
+	fmt.Println(ctl+" service success, pid", pid)
+	return nil
 }
 
-// ServerCmd represents the server command
+// svcAction 使用当前 init 后端执行 start/stop/restart
+func svcAction(ctl string) error {
+	s, err := initSystem()
+	if err != nil {
+		return err
+	}
+	return ctlSvc(s, ctl)
+}
 
 func addSvc() {
-	// RootCmd.AddCommand(serverCmd)
 	RootCmd.AddCommand(svcCmd)
 	RootCmd.AddCommand(installCmd)
 	RootCmd.AddCommand(uninstallCmd)
@@ -135,19 +198,10 @@ func addSvc() {
 	RootCmd.AddCommand(restartCmd)
 }
 
-const svcText = `[Unit]
-Description=%s
-After=network.target
- 
-[Service]
-Type=simple
-WorkingDirectory=%s
-ExecStart=%s/%s
-Restart=on-failure
-RestartSec=10
-LimitNOFILE=6553500 
-LimitNPROC=6553500 
-
-
-[Install]
-WantedBy=multi-user.target`
+func init() {
+	addUnitFlags(installCmd)
+	for _, c := range []*cobra.Command{installCmd, uninstallCmd, startCmd, stopCmd, restartCmd, statusCmd} {
+		c.Flags().DurationVar(&svcTimeout, "timeout", 30*time.Second, "wait service start or stop timeout")
+		c.SilenceUsage = true
+	}
+}
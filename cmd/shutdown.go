@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// 进程退出码
+const (
+	EXIT_OK      = 0 // 正常退出
+	EXIT_ERROR   = 1 // 退出钩子返回错误
+	EXIT_TIMEOUT = 2 // 退出钩子或主函数超时
+	EXIT_PANIC   = 3 // 主函数 panic 导致退出
+)
+
+type shutdownHook struct {
+	name     string
+	priority int
+	timeout  time.Duration
+	fn       func(ctx context.Context) error
+}
+
+var (
+	hookMu   sync.Mutex
+	hooks    []*shutdownHook
+	exitCode int32
+)
+
+// OnShutdown 注册退出钩子
+// 收到 SIGINT/SIGTERM/SIGQUIT 或调用 Quit() 后,按 priority 从小到大依次执行,priority 相同按注册顺序执行
+// timeout 为单个钩子的超时时间,<=0 时只受全局超时(WithShutdownTimeout)限制
+func OnShutdown(name string, priority int, timeout time.Duration, fn func(ctx context.Context) error) {
+	if fn == nil {
+		return
+	}
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	hooks = append(hooks, &shutdownHook{
+		name:     name,
+		priority: priority,
+		timeout:  timeout,
+		fn:       fn,
+	})
+}
+
+// hookMark 返回当前退出钩子数量,用于主函数重启时回滚
+func hookMark() int {
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	return len(hooks)
+}
+
+// resetHooks 移除 mark 之后注册的退出钩子
+func resetHooks(mark int) {
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	hooks = hooks[:mark]
+}
+
+// setExitCode 记录退出码,只保留最严重的一个
+func setExitCode(code int) {
+	for {
+		old := atomic.LoadInt32(&exitCode)
+		if int32(code) <= old || atomic.CompareAndSwapInt32(&exitCode, old, int32(code)) {
+			return
+		}
+	}
+}
+
+// ExitCode 返回进程退出时使用的退出码
+func ExitCode() int {
+	return int(atomic.LoadInt32(&exitCode))
+}
+
+// shutdown 按顺序执行退出钩子,然后等待主函数退出,全程受全局超时限制
+func shutdown(wg *sync.WaitGroup) int {
+	ctx, cancel := context.WithTimeout(context.Background(), defOpt.shutdownTimeout)
+	defer cancel()
+	stopSupervisor()
+	// 平滑升级后主进程已交给新进程,不能再通知 systemd 退出
+	if atomic.LoadInt32(&handedOver) == 0 {
+		notifyStopping()
+	} else {
+		stopWatchdog()
+	}
+
+	hookMu.Lock()
+	list := make([]*shutdownHook, len(hooks))
+	copy(list, hooks)
+	hookMu.Unlock()
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].priority < list[j].priority
+	})
+
+	for i, h := range list {
+		if ctx.Err() != nil {
+			for _, s := range list[i:] {
+				logger.Errorw("shutdown hook skipped", "name", s.name, "err", ctx.Err())
+			}
+			setExitCode(EXIT_TIMEOUT)
+			break
+		}
+		if atomic.LoadInt32(&handedOver) == 0 {
+			NotifyStatus("stopping " + h.name)
+		}
+		runHook(ctx, h)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Errorln("shutdown wait main func timeout", defOpt.shutdownTimeout)
+		setExitCode(EXIT_TIMEOUT)
+	}
+	return ExitCode()
+}
+
+func runHook(parent context.Context, h *shutdownHook) {
+	ctx, cancel := parent, context.CancelFunc(func() {})
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, h.timeout)
+	}
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer OnPanic(func(a any, s string) {
+			done <- fmt.Errorf("panic: %v", a)
+		})
+		done <- h.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			logger.Errorw("shutdown hook failed", "name", h.name, "err", err)
+			setExitCode(EXIT_ERROR)
+			return
+		}
+		logger.Infow("shutdown hook done", "name", h.name, "cost", time.Since(start).String())
+	case <-ctx.Done():
+		logger.Errorw("shutdown hook timeout", "name", h.name, "err", ctx.Err())
+		setExitCode(EXIT_TIMEOUT)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetShutdown 清空退出钩子和退出码,测试结束后恢复全局超时
+func resetShutdown(t *testing.T, timeout time.Duration) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	old := defOpt.shutdownTimeout
+	defOpt.shutdownTimeout = timeout
+	hooks = nil
+	atomic.StoreInt32(&exitCode, EXIT_OK)
+	t.Cleanup(func() {
+		defOpt.shutdownTimeout = old
+		hooks = nil
+		atomic.StoreInt32(&exitCode, EXIT_OK)
+	})
+}
+
+func TestShutdownHookOrder(t *testing.T) {
+	resetShutdown(t, time.Second)
+	var mu sync.Mutex
+	var order []string
+	hook := func(name string, priority int) {
+		OnShutdown(name, priority, 0, func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		})
+	}
+	hook("db", 10)
+	hook("http", 0)
+	hook("cache", 10)
+	hook("grpc", 0)
+
+	var wg sync.WaitGroup
+	if code := shutdown(&wg); code != EXIT_OK {
+		t.Fatal("exit code", code)
+	}
+	if want := []string{"http", "grpc", "db", "cache"}; !reflect.DeepEqual(order, want) {
+		t.Fatal(order)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}
+	cases := []struct {
+		name  string
+		setup func(wg *sync.WaitGroup)
+		code  int
+	}{
+		{"hook error", func(wg *sync.WaitGroup) {
+			OnShutdown("err", 0, 0, func(ctx context.Context) error { return context.Canceled })
+		}, EXIT_ERROR},
+		{"hook timeout", func(wg *sync.WaitGroup) {
+			OnShutdown("slow", 0, 20*time.Millisecond, block)
+		}, EXIT_TIMEOUT},
+		{"hook panic", func(wg *sync.WaitGroup) {
+			OnShutdown("panic", 0, 0, func(ctx context.Context) error { panic("boom") })
+		}, EXIT_ERROR},
+		{"global timeout", func(wg *sync.WaitGroup) {
+			OnShutdown("slow", 0, 0, block)
+			OnShutdown("skipped", 1, 0, func(ctx context.Context) error { return nil })
+		}, EXIT_TIMEOUT},
+		{"main func timeout", func(wg *sync.WaitGroup) {
+			wg.Add(1)
+		}, EXIT_TIMEOUT},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resetShutdown(t, 100*time.Millisecond)
+			var wg sync.WaitGroup
+			c.setup(&wg)
+			start := time.Now()
+			if code := shutdown(&wg); code != c.code {
+				t.Fatal("exit code", code)
+			}
+			if cost := time.Since(start); cost > time.Second {
+				t.Fatal("shutdown cost", cost)
+			}
+		})
+	}
+}
+
+func TestWaitQuitBroadcast(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-WaitQuit()
+		}()
+	}
+	closeQuit()
+	closeQuit()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waiters not notified")
+	}
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+var (
+	startTime  = time.Now()
+	ipcClients int32
+)
+
+type MemStats struct {
+	Alloc       uint64    `json:"alloc"`
+	TotalAlloc  uint64    `json:"totalAlloc"`
+	Sys         uint64    `json:"sys"`
+	HeapInuse   uint64    `json:"heapInuse"`
+	HeapObjects uint64    `json:"heapObjects"`
+	NumGC       uint32    `json:"numGC"`
+	PauseTotal  string    `json:"pauseTotal"`
+	LastGC      time.Time `json:"lastGC"`
+}
+
+// Stats 运行时状态
+type Stats struct {
+	App        string    `json:"app"`
+	Version    string    `json:"version"`
+	Pid        int       `json:"pid"`
+	StartTime  time.Time `json:"startTime"`
+	Uptime     string    `json:"uptime"`
+	Goroutines int       `json:"goroutines"`
+	Mem        MemStats  `json:"mem"`
+	OpenFiles  int       `json:"openFiles"`
+	LogLevel   string    `json:"logLevel"`
+	LogFile    string    `json:"logFile"`
+	IPCClients int       `json:"ipcClients"`
+	// WithSupervisor 重启主函数次数
+	Restarts int `json:"restarts"`
+}
+
+func collectStats() *Stats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	st := &Stats{
+		App:        svcName(),
+		Version:    Version,
+		Pid:        os.Getpid(),
+		StartTime:  startTime,
+		Uptime:     time.Since(startTime).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Mem: MemStats{
+			Alloc:       m.Alloc,
+			TotalAlloc:  m.TotalAlloc,
+			Sys:         m.Sys,
+			HeapInuse:   m.HeapInuse,
+			HeapObjects: m.HeapObjects,
+			NumGC:       m.NumGC,
+			PauseTotal:  time.Duration(m.PauseTotalNs).String(),
+		},
+		OpenFiles:  openFiles(),
+		LogLevel:   logger.GetLevel().String(),
+		IPCClients: int(atomic.LoadInt32(&ipcClients)),
+		Restarts:   supervisorStats().Restarts,
+	}
+	if m.LastGC > 0 {
+		st.Mem.LastGC = time.Unix(0, int64(m.LastGC))
+	}
+	if activeLog != nil {
+		st.LogFile = activeLog.filename
+	}
+	return st
+}
+
+// openFiles 统计打开的文件描述符数量,不支持时返回 -1
+// linux 读取 /proc/self/fd,darwin/bsd 读取 /dev/fd,结果不包括读取目录自身的描述符
+func openFiles() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if fds, err := os.ReadDir(dir); err == nil {
+			return len(fds) - 1
+		}
+	}
+	return -1
+}
+
+func fmtBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func (st *Stats) String() string {
+	return fmt.Sprintf(`app:         %s
+version:     %s
+pid:         %d
+start:       %s
+uptime:      %s
+goroutines:  %d
+mem.alloc:   %s
+mem.sys:     %s
+mem.heap:    %s (%d objects)
+gc:          %d (pause %s)
+open files:  %d
+log level:   %s
+log file:    %s
+ipc clients: %d
+restarts:    %d`,
+		st.App, st.Version, st.Pid, st.StartTime.Format("2006-01-02 15:04:05"), st.Uptime,
+		st.Goroutines, fmtBytes(st.Mem.Alloc), fmtBytes(st.Mem.Sys), fmtBytes(st.Mem.HeapInuse), st.Mem.HeapObjects,
+		st.Mem.NumGC, st.Mem.PauseTotal, st.OpenFiles, st.LogLevel, st.LogFile, st.IPCClients, st.Restarts)
+}
+
+var statsJSON bool
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "stats",
+	Long:  `show running service stats`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		resp, err := CallIPC("stats", nil)
+		if err != nil {
+			return fmt.Errorf("please check application not running: %w", err)
+		}
+		if err = resp.Err(); err != nil {
+			return err
+		}
+		if statsJSON {
+			fmt.Println(string(resp.Data))
+			return nil
+		}
+		var st Stats
+		if err = json.Unmarshal(resp.Data, &st); err != nil {
+			return err
+		}
+		fmt.Println(st.String())
+		return nil
+	},
+}
+
+func init() {
+	RegisterIPC("stats", IPCHandler{
+		Short: "show running service stats",
+		Handle: func(req *IPCRequest) (any, error) {
+			return collectStats(), nil
+		},
+	})
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "output json")
+	statsCmd.SilenceUsage = true
+	RootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestOpenFiles(t *testing.T) {
+	n := openFiles()
+	if n < 0 {
+		t.Skip("open files not supported")
+	}
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got := openFiles(); got != n+1 {
+		t.Fatal(n, got)
+	}
+}
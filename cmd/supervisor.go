@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// 保留最近的崩溃记录数量
+const maxCrashRecords = 20
+
+// SupervisorPolicy 主函数 panic 后在进程内重启的策略,零值字段使用默认值
+type SupervisorPolicy struct {
+	// 首次重启等待时间,默认 1s,之后每次乘以 Multiplier
+	InitialBackoff time.Duration
+	// 最大等待时间,默认 1m
+	MaxBackoff time.Duration
+	// 退避倍数,默认 2
+	Multiplier float64
+	// Window 时间内重启超过 MaxRestarts 次视为崩溃循环,退出进程交给 init 系统处理
+	// 默认 10 分钟内 5 次
+	MaxRestarts int
+	Window      time.Duration
+	// 主函数运行超过该时间后再崩溃时重置等待时间,默认 1m
+	ResetAfter time.Duration
+}
+
+// CrashRecord 主函数崩溃记录
+type CrashRecord struct {
+	Time  time.Time `json:"time"`
+	Panic string    `json:"panic"`
+	Stack string    `json:"stack"`
+	// 崩溃前运行时长
+	Uptime string `json:"uptime"`
+}
+
+// SupervisorStats 重启统计
+type SupervisorStats struct {
+	Restarts int           `json:"restarts"`
+	Crashes  []CrashRecord `json:"crashes"`
+}
+
+var (
+	supervisorMu   sync.Mutex
+	restarts       int
+	crashes        []CrashRecord
+	supervisorOnce sync.Once
+	supervisorDone = make(chan struct{})
+)
+
+// WithSupervisor 主函数 panic 时按 policy 在进程内重启,而不是退出进程
+// 只能捕获主函数所在协程的 panic,主函数启动的其他协程 panic 仍会导致进程退出
+func WithSupervisor(policy SupervisorPolicy) Option {
+	return func(opt *cmdOpt) {
+		if policy.InitialBackoff <= 0 {
+			policy.InitialBackoff = time.Second
+		}
+		if policy.MaxBackoff <= 0 {
+			policy.MaxBackoff = time.Minute
+		}
+		if policy.Multiplier < 1 {
+			policy.Multiplier = 2
+		}
+		if policy.MaxRestarts <= 0 {
+			policy.MaxRestarts = 5
+		}
+		if policy.Window <= 0 {
+			policy.Window = 10 * time.Minute
+		}
+		if policy.ResetAfter <= 0 {
+			policy.ResetAfter = time.Minute
+		}
+		opt.supervisor = &policy
+	}
+}
+
+// stopSupervisor 退出时不再重启主函数
+func stopSupervisor() {
+	supervisorOnce.Do(func() {
+		close(supervisorDone)
+	})
+}
+
+// supervisorStats 返回重启次数和崩溃记录
+func supervisorStats() SupervisorStats {
+	supervisorMu.Lock()
+	defer supervisorMu.Unlock()
+	list := make([]CrashRecord, len(crashes))
+	copy(list, crashes)
+	return SupervisorStats{Restarts: restarts, Crashes: list}
+}
+
+func recordCrash(c CrashRecord) {
+	supervisorMu.Lock()
+	defer supervisorMu.Unlock()
+	crashes = append(crashes, c)
+	if len(crashes) > maxCrashRecords {
+		crashes = crashes[len(crashes)-maxCrashRecords:]
+	}
+}
+
+// callMain 执行主函数,panic 时返回崩溃记录
+func callMain(args []string) (crash *CrashRecord) {
+	start := time.Now()
+	defer OnPanic(func(a any, s string) {
+		crash = &CrashRecord{
+			Time:   time.Now(),
+			Panic:  fmt.Sprint(a),
+			Stack:  s,
+			Uptime: time.Since(start).Round(time.Millisecond).String(),
+		}
+	})
+	svcFunc(args)
+	return nil
+}
+
+// runMain 执行主函数,未开启 WithSupervisor 时 panic 直接退出进程
+// 主函数正常返回时 ok 为 true
+func runMain(args []string) (ok bool) {
+	p := defOpt.supervisor
+	if p == nil {
+		defer OnPanic(func(a any, s string) {
+			ok = false
+			setExitCode(EXIT_PANIC)
+			sig <- syscall.SIGTERM
+		})
+		svcFunc(args)
+		return true
+	}
+	backoff := p.InitialBackoff
+	var history []time.Time
+	hookN, handoverN := hookMark(), handoverMark()
+	for {
+		start := time.Now()
+		crash := callMain(args)
+		if crash == nil {
+			return true
+		}
+		recordCrash(*crash)
+		// 重启后主函数会重新注册,丢弃崩溃前注册的退出钩子并关闭监听,避免重复执行和端口占用
+		resetHooks(hookN)
+		resetHandovers(handoverN)
+
+		// 统计窗口内的重启次数
+		now := time.Now()
+		list := history[:0]
+		for _, t := range history {
+			if now.Sub(t) < p.Window {
+				list = append(list, t)
+			}
+		}
+		history = list
+		if len(history) >= p.MaxRestarts {
+			logger.Errorw("main func crash loop, quit", "restarts", len(history), "window", p.Window.String())
+			setExitCode(EXIT_PANIC)
+			sig <- syscall.SIGTERM
+			return false
+		}
+		if time.Since(start) > p.ResetAfter {
+			backoff = p.InitialBackoff
+		}
+		logger.Warnw("main func panic, restart", "panic", crash.Panic, "backoff", backoff.String())
+		select {
+		case <-time.After(backoff):
+		case <-supervisorDone:
+			return false
+		}
+		history = append(history, time.Now())
+		supervisorMu.Lock()
+		restarts++
+		supervisorMu.Unlock()
+		if backoff = time.Duration(float64(backoff) * p.Multiplier); backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+func init() {
+	RegisterIPC("supervisor", IPCHandler{
+		Short: "show main func restart count and crash records",
+		Handle: func(req *IPCRequest) (any, error) {
+			return supervisorStats(), nil
+		},
+	})
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// resetSupervisor 使用较短的重启策略,测试结束后恢复全局状态
+func resetSupervisor(t *testing.T, policy SupervisorPolicy) {
+	resetShutdown(t, time.Second)
+	oldOpt, oldFunc := defOpt.supervisor, svcFunc
+	WithSupervisor(policy)(defOpt)
+	supervisorOnce, supervisorDone = sync.Once{}, make(chan struct{})
+	restarts, crashes = 0, nil
+	mark := handoverMark()
+	t.Cleanup(func() {
+		defOpt.supervisor, svcFunc = oldOpt, oldFunc
+		restarts, crashes = 0, nil
+		resetHandovers(mark)
+	})
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	resetSupervisor(t, SupervisorPolicy{
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     30 * time.Millisecond,
+		MaxRestarts:    5,
+	})
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	var starts []time.Time
+	svcFunc = func([]string) {
+		starts = append(starts, time.Now())
+		OnShutdown("http", 0, 0, func(ctx context.Context) error { return nil })
+		// 崩溃前的监听未关闭时重新监听会失败
+		if _, err := Listen("tcp", addr); err != nil {
+			t.Error(err)
+			return
+		}
+		if len(starts) < 4 {
+			panic("boom")
+		}
+	}
+	if !runMain(nil) {
+		t.Fatal("expect ok")
+	}
+	if st := supervisorStats(); st.Restarts != 3 || len(st.Crashes) != 3 {
+		t.Fatal(st.Restarts, len(st.Crashes))
+	}
+	if n := hookMark(); n != 1 {
+		t.Fatal("hooks", n)
+	}
+	// 退避时间 20ms、40ms 超过上限取 30ms、30ms
+	for i, want := range []time.Duration{20, 30, 30} {
+		if cost := starts[i+1].Sub(starts[i]); cost < want*time.Millisecond {
+			t.Fatal("backoff", i, cost)
+		}
+	}
+}
+
+func TestSupervisorCrashLoop(t *testing.T) {
+	resetSupervisor(t, SupervisorPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxRestarts:    2,
+	})
+	calls := 0
+	svcFunc = func([]string) {
+		calls++
+		panic("boom")
+	}
+	if runMain(nil) {
+		t.Fatal("expect crash loop")
+	}
+	if s := <-sig; s == nil || ExitCode() != EXIT_PANIC {
+		t.Fatal(s, ExitCode())
+	}
+	if calls != 3 || supervisorStats().Restarts != 2 {
+		t.Fatal(calls, supervisorStats().Restarts)
+	}
+}
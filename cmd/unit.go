@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// UnitOptions 生成服务配置文件的配置,资源限制和安全加固等仅 systemd 支持的配置项在其他 init 下忽略
+type UnitOptions struct {
+	Description string
+	User        string
+	Group       string
+	// 环境变量文件,前缀 - 表示文件不存在时忽略
+	EnvFiles []string
+	// 环境变量,格式 KEY=VALUE
+	Env []string
+	// 追加到启动命令的参数
+	Args  []string
+	After []string
+	Wants []string
+	// 重启策略: no,on-success,on-failure,on-abnormal,on-watchdog,on-abort,always
+	Restart    string
+	RestartSec int
+	// 资源限制,0 或空表示不设置
+	LimitNOFILE int
+	LimitNPROC  int
+	MemoryMax   string
+	CPUQuota    string
+	// 安全加固: ProtectSystem=true|full|strict
+	ProtectSystem   string
+	NoNewPrivileges bool
+}
+
+// 默认 unit 配置
+func defUnitOptions() UnitOptions {
+	return UnitOptions{
+		After:       []string{"network.target"},
+		Restart:     "on-failure",
+		RestartSec:  10,
+		LimitNOFILE: 6553500,
+		LimitNPROC:  6553500,
+	}
+}
+
+// WithUnitOptions 在默认配置基础上修改 install 生成的 systemd unit 配置,命令行参数优先
+func WithUnitOptions(fn func(u *UnitOptions)) Option {
+	return func(opt *cmdOpt) {
+		fn(&opt.unit)
+	}
+}
+
+// unitFlags install 命令的 unit 参数
+var unitFlags = struct {
+	user, group, restart, memoryMax, cpuQuota, protectSystem string
+	envFiles, env, args, after, wants                        []string
+	restartSec, limitNOFILE, limitNPROC                      int
+	noNewPrivileges, dryRun                                  bool
+}{}
+
+func addUnitFlags(c *cobra.Command) {
+	f := c.Flags()
+	f.StringVar(&unitFlags.user, "service-user", "", "run service as user")
+	f.StringVar(&unitFlags.group, "service-group", "", "run service as group")
+	f.StringArrayVar(&unitFlags.envFiles, "env-file", nil, "EnvironmentFile, can be repeated")
+	f.StringArrayVar(&unitFlags.env, "env", nil, "Environment KEY=VALUE, can be repeated")
+	f.StringArrayVar(&unitFlags.args, "args", nil, "extra service argument, can be repeated")
+	f.StringArrayVar(&unitFlags.after, "after", nil, "After dependency, can be repeated")
+	f.StringArrayVar(&unitFlags.wants, "wants", nil, "Wants dependency, can be repeated")
+	f.StringVar(&unitFlags.restart, "restart", "", "Restart policy")
+	f.IntVar(&unitFlags.restartSec, "restart-sec", 0, "RestartSec seconds")
+	f.IntVar(&unitFlags.limitNOFILE, "limit-nofile", 0, "LimitNOFILE")
+	f.IntVar(&unitFlags.limitNPROC, "limit-nproc", 0, "LimitNPROC")
+	f.StringVar(&unitFlags.memoryMax, "memory-max", "", "MemoryMax, e.g. 512M")
+	f.StringVar(&unitFlags.cpuQuota, "cpu-quota", "", "CPUQuota, e.g. 200%")
+	f.StringVar(&unitFlags.protectSystem, "protect-system", "", "ProtectSystem: true|full|strict")
+	f.BoolVar(&unitFlags.noNewPrivileges, "no-new-privileges", false, "NoNewPrivileges=true")
+	f.BoolVar(&unitFlags.dryRun, "dry-run", false, "print generated service file without installing")
+}
+
+// unitOptions 合并 WithUnitOptions 和命令行参数
+func unitOptions(c *cobra.Command) UnitOptions {
+	u := defOpt.unit
+	f := c.Flags()
+	if f.Changed("service-user") {
+		u.User = unitFlags.user
+	}
+	if f.Changed("service-group") {
+		u.Group = unitFlags.group
+	}
+	if f.Changed("env-file") {
+		u.EnvFiles = unitFlags.envFiles
+	}
+	if f.Changed("env") {
+		u.Env = unitFlags.env
+	}
+	if f.Changed("args") {
+		u.Args = unitFlags.args
+	}
+	if f.Changed("after") {
+		u.After = unitFlags.after
+	}
+	if f.Changed("wants") {
+		u.Wants = unitFlags.wants
+	}
+	if f.Changed("restart") {
+		u.Restart = unitFlags.restart
+	}
+	if f.Changed("restart-sec") {
+		u.RestartSec = unitFlags.restartSec
+	}
+	if f.Changed("limit-nofile") {
+		u.LimitNOFILE = unitFlags.limitNOFILE
+	}
+	if f.Changed("limit-nproc") {
+		u.LimitNPROC = unitFlags.limitNPROC
+	}
+	if f.Changed("memory-max") {
+		u.MemoryMax = unitFlags.memoryMax
+	}
+	if f.Changed("cpu-quota") {
+		u.CPUQuota = unitFlags.cpuQuota
+	}
+	if f.Changed("protect-system") {
+		u.ProtectSystem = unitFlags.protectSystem
+	}
+	if f.Changed("no-new-privileges") {
+		u.NoNewPrivileges = unitFlags.noNewPrivileges
+	}
+	// 用户服务无权提高资源上限,未指定时不设置
+	if userMode && !f.Changed("limit-nofile") {
+		u.LimitNOFILE = 0
+	}
+	if userMode && !f.Changed("limit-nproc") {
+		u.LimitNPROC = 0
+	}
+	return u
+}
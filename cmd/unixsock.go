@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
+	"io"
 	"net"
 	"os"
 	"runtime"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -14,30 +17,40 @@ import (
 )
 
 var (
+	// Deprecated: 使用 RegisterIPC 注册命令
 	IPCMsg func(msg string) string
 	// sock      = tools.CurrentName() + ".ipc"
 	ulistener net.Listener
 )
 
 func stopUnixSock() {
-	if ulistener != nil {
+	if ulistener != nil && atomic.LoadInt32(&handedOver) == 0 {
 		os.Remove(defOpt.ipcPath)
 	}
 }
+
+// IsRuning 是否已有实例持有 pid 文件锁
 func IsRuning() bool {
-	p := tools.FixPath(defOpt.ipcPath)
-	dial, err := net.Dial("unix", p)
-	if err == nil {
-		dial.Close()
-	} else {
-		os.Remove(p)
-	}
-	return err == nil
+	_, ok := runningPid()
+	return ok
 }
 func startUnixSock() error {
 	// addr, _ := net.ResolveUnixAddr("unix", sock)
 	var err error
-	ulistener, err = net.Listen("unix", defOpt.ipcPath)
+	if !peerCredSupported {
+		logger.Warnln("ipc peer credentials unavailable on this platform, only stats/config/supervisor are allowed")
+	}
+	if l, ok := inheritListener("unix", defOpt.ipcPath); ok {
+		ulistener = l
+		addHandover(listenKey("unix", defOpt.ipcPath), l)
+		go acceptIPC()
+		return nil
+	}
+	// 已持有实例锁,残留的 socket 文件可以安全删除
+	if tools.FileExists(defOpt.ipcPath) {
+		os.Remove(defOpt.ipcPath)
+	}
+	ulistener, err = listenUnix(defOpt.ipcPath)
 	if err != nil {
 		if isErrorAddressAlreadyInUse(err) {
 			logger.Errorf("please check application already running.")
@@ -46,61 +59,139 @@ func startUnixSock() error {
 		}
 		return err
 	}
-	go func() {
-		defer OnPanic(nil)
-		defer ulistener.Close()
-		for {
-			conn, err := ulistener.Accept()
-			if err != nil {
-				continue
+	addHandover(listenKey("unix", defOpt.ipcPath), ulistener)
+	go acceptIPC()
+	return nil
+}
+
+func acceptIPC() {
+	defer OnPanic(nil)
+	defer ulistener.Close()
+	for {
+		conn, err := ulistener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
-			go func(con net.Conn) {
-				defer con.Close()
-				reader := bufio.NewReader(conn)
-				msg, err := reader.ReadSlice(0)
-				if err != nil {
-					return
-				}
-				logger.Println("uread:", msg)
-				message := string(msg[:len(msg)-1])
-				if message == "dbg" {
-					DEBUG = !DEBUG
-					if DEBUG {
-						logger.SetLevel(zap.DebugLevel)
-						conn.Write([]byte("debug true\x00"))
-					} else {
-						logger.SetLevel(zap.InfoLevel)
-						logger.Println("debug false")
-						conn.Write([]byte("debug false\x00"))
-					}
-					logger.Debugln("debug =>", DEBUG)
-				} else if IPCMsg != nil {
-					rest := IPCMsg(message)
-					conn.Write([]byte(rest + "\x00"))
-				}
-			}(conn)
+			continue
 		}
-	}()
-	return nil
+		go serveIPC(conn)
+	}
 }
 
-func SendMsgToIPC(msg string) (string, error) {
+// serveIPC 处理一个连接上的请求,一个连接可以连续发送多个请求
+func serveIPC(conn net.Conn) {
 	defer OnPanic(nil)
+	defer conn.Close()
+	atomic.AddInt32(&ipcClients, 1)
+	defer atomic.AddInt32(&ipcClients, -1)
+	cred := peerCred(conn)
+	reader := bufio.NewReader(conn)
+	for {
+		var req IPCRequest
+		req.cred = cred
+		if err := readJSONFrame(reader, &req); err != nil {
+			if err != io.EOF {
+				logger.Debugln("ipc read", err)
+			}
+			return
+		}
+		logger.Debugw("ipc request", "id", req.Id, "cmd", req.Cmd, "args", req.Args)
+		resp, stream := handleIPC(&req)
+		if err := writeJSONFrame(conn, resp); err != nil {
+			logger.Debugln("ipc write", err)
+			return
+		}
+		if stream == nil {
+			continue
+		}
+		trailer := &IPCResponse{Id: req.Id}
+		if err := writeStream(conn, stream); err != nil {
+			logger.Errorw("ipc stream", "cmd", req.Cmd, "err", err)
+			trailer.Code, trailer.Msg = IPC_INTERNAL, err.Error()
+		}
+		if err := writeJSONFrame(conn, trailer); err != nil {
+			logger.Debugln("ipc write", err)
+			return
+		}
+	}
+}
+
+// CallIPC 向运行中的服务发送 IPC 命令
+func CallIPC(name string, args map[string]string) (*IPCResponse, error) {
+	return callIPC(name, args, nil, defOpt.ipcTimeout)
+}
+
+// CallIPCStream 发送 IPC 命令,并将流式响应数据写入 w
+// timeout 为整个请求的超时时间
+func CallIPCStream(name string, args map[string]string, w io.Writer, timeout time.Duration) (*IPCResponse, error) {
+	return callIPC(name, args, w, timeout)
+}
+
+func callIPC(name string, args map[string]string, w io.Writer, timeout time.Duration) (*IPCResponse, error) {
 	dial, err := net.Dial("unix", defOpt.ipcPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer dial.Close()
-	dial.Write([]byte(msg + "\x00"))
-	dial.SetDeadline(time.Now().Add(5 * time.Second))
+	dial.SetDeadline(time.Now().Add(timeout))
 
-	reader := bufio.NewReaderSize(dial, 1024*1024)
+	req := &IPCRequest{Id: tools.GenId(), Cmd: name, Args: args}
+	if err = writeJSONFrame(dial, req); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(dial)
+	var resp IPCResponse
+	if err = readJSONFrame(reader, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Id != req.Id {
+		return nil, errors.New("ipc response id mismatch")
+	}
+	if !resp.Stream {
+		return &resp, nil
+	}
+	if w == nil {
+		w = io.Discard
+	}
+	for {
+		buf, err := readFrame(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) == 0 {
+			break
+		}
+		if _, err = w.Write(buf); err != nil {
+			return nil, err
+		}
+	}
+	var trailer IPCResponse
+	if err = readJSONFrame(reader, &trailer); err != nil {
+		return nil, err
+	}
+	return &trailer, nil
+}
 
-	buf, err := reader.ReadSlice(0)
-	if len(buf) > 0 {
-		buf = buf[:len(buf)-1]
+// SendMsgToIPC 发送文本命令,已注册的命令直接调用,否则交给 IPCMsg 处理
+//
+// Deprecated: 使用 CallIPC
+func SendMsgToIPC(msg string) (string, error) {
+	defer OnPanic(nil)
+	var resp *IPCResponse
+	var err error
+	if getIPC(msg) != nil {
+		resp, err = CallIPC(msg, nil)
+	} else {
+		resp, err = CallIPC("msg", map[string]string{"text": msg})
 	}
-	return string(buf), err
+	if err != nil {
+		return "", err
+	}
+	if err = resp.Err(); err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
 }
 func isErrorAddressAlreadyInUse(err error) bool {
 	errOpError, ok := err.(*net.OpError)
@@ -124,3 +215,40 @@ func isErrorAddressAlreadyInUse(err error) bool {
 	}
 	return false
 }
+
+func init() {
+	RegisterIPC("dbg", IPCHandler{
+		Short: "toggle debug mode",
+		Handle: func(req *IPCRequest) (any, error) {
+			DEBUG = !DEBUG
+			if DEBUG {
+				logger.SetLevel(zap.DebugLevel)
+				return "debug true", nil
+			}
+			logger.SetLevel(zap.InfoLevel)
+			logger.Println("debug false")
+			return "debug false", nil
+		},
+	})
+	RegisterIPC("reload", IPCHandler{
+		Short: "reload config and reopen log file",
+		Handle: func(req *IPCRequest) (any, error) {
+			if err := Reload(); err != nil {
+				return nil, err
+			}
+			return "reload success", nil
+		},
+	})
+	RegisterIPC("msg", IPCHandler{
+		Short: "send text message to IPCMsg",
+		Args: []IPCArg{
+			{Name: "text", Type: ARG_STRING, Usage: "message text"},
+		},
+		Handle: func(req *IPCRequest) (any, error) {
+			if IPCMsg == nil {
+				return nil, NewIPCError(IPC_NOT_FOUND, "IPCMsg not set")
+			}
+			return IPCMsg(req.String("text")), nil
+		},
+	})
+}
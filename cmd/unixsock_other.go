@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// listenUnix 在 0700 临时目录中创建 socket,设置权限和所属用户后再移动到 path
+// 避免设置权限之前其他用户连接
+func listenUnix(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".ipc")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(tmp, defOpt.ipcMode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if defOpt.ipcUid >= 0 || defOpt.ipcGid >= 0 {
+		if err = os.Chown(tmp, defOpt.ipcUid, defOpt.ipcGid); err != nil {
+			logger.Warnln("usock chown", err)
+		}
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
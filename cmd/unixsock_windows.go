@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"net"
+	"os"
+
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+// listenUnix windows 下文件权限不限制 socket 访问,只尝试设置
+func listenUnix(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, defOpt.ipcMode); err != nil {
+		logger.Warnln("usock chmod", err)
+	}
+	return l, nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+var (
+	readyOnce  sync.Once
+	upgrading  int32
+	handedOver int32
+)
+
+func listenKey(network, addr string) string {
+	return network + ":" + addr
+}
+
+// Ready 通知服务已就绪
+// 平滑升级时父进程收到通知后才会退出
+// 未设置 WithManualReady/WithNotify/WithWatchdog 时,主函数正常返回后自动调用
+// 主函数阻塞运行时需要自行调用,否则平滑升级等待就绪超时
+// 由 systemd 启动时同时发送 READY=1
+func Ready() {
+	readyOnce.Do(func() {
+		notifyParent()
+		notifyReady()
+	})
+}
+
+// upgrade 启动新进程并交接监听,等待新进程就绪最长 timeout,成功后当前进程需要退出
+func upgrade(timeout time.Duration) (int, error) {
+	if !atomic.CompareAndSwapInt32(&upgrading, 0, 1) {
+		return 0, errors.New("upgrade already in progress")
+	}
+	pid, err := startUpgrade(timeout)
+	if err != nil {
+		restoreLockInfo()
+		atomic.StoreInt32(&upgrading, 0)
+		logger.Errorln("upgrade failed", err)
+		return 0, err
+	}
+	atomic.StoreInt32(&handedOver, 1)
+	logger.Infoln("upgrade success, new pid", pid)
+	return pid, nil
+}
+
+// ipcUpgrade 通知运行中的服务使用当前程序平滑升级
+func ipcUpgrade(timeout time.Duration) (string, error) {
+	resp, err := callIPC("upgrade", map[string]string{"timeout": timeout.String()}, nil, timeout+defOpt.ipcTimeout)
+	if err != nil {
+		return "", fmt.Errorf("please check application not running: %w", err)
+	}
+	if err = resp.Err(); err != nil {
+		return "", err
+	}
+	return resp.Text(), nil
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "upgrade",
+	Long: `zero-downtime restart running service with current binary,
+or replace binary with --from <file|url> and restart, rollback if new binary not answer ipc`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout := updateFlags.timeout
+		if timeout <= 0 {
+			timeout = defOpt.upgradeTimeout
+		}
+		if updateFlags.from != "" {
+			if err := selfUpdate(updateFlags.from, updateFlags.sha256, timeout); err != nil {
+				return err
+			}
+			fmt.Println("upgrade success")
+			return nil
+		}
+		msg, err := ipcUpgrade(timeout)
+		if err != nil {
+			return err
+		}
+		fmt.Println(msg)
+		return nil
+	},
+}
+
+func init() {
+	RegisterIPC("upgrade", IPCHandler{
+		Short: "zero-downtime restart with current binary",
+		Args: []IPCArg{
+			{Name: "timeout", Type: ARG_DURATION, Default: "0s", Usage: "wait new process ready timeout (default upgrade timeout)"},
+		},
+		Handle: func(req *IPCRequest) (any, error) {
+			timeout := req.Duration("timeout")
+			if timeout <= 0 {
+				timeout = defOpt.upgradeTimeout
+			}
+			pid, err := upgrade(timeout)
+			if err != nil {
+				return nil, err
+			}
+			// 响应发送后再退出
+			time.AfterFunc(100*time.Millisecond, func() {
+				sig <- syscall.SIGTERM
+			})
+			return fmt.Sprintf("upgrade success, new pid %d", pid), nil
+		},
+	})
+	f := upgradeCmd.Flags()
+	f.StringVar(&updateFlags.from, "from", "", "new binary file path or http(s) url")
+	f.StringVar(&updateFlags.sha256, "sha256", "", "sha256 of new binary, required for http://, read <from>.sha256 if empty")
+	f.DurationVar(&updateFlags.timeout, "timeout", 0, "wait new process answer ipc timeout (default upgrade timeout)")
+	upgradeCmd.SilenceUsage = true
+	RootCmd.AddCommand(upgradeCmd)
+}
@@ -0,0 +1,252 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zhiyin2021/zycli/tools"
+	"github.com/zhiyin2021/zycli/tools/logger"
+)
+
+const (
+	// envListenFds 父进程交接的监听列表,按顺序对应 fd 3,4,5...
+	envListenFds = "ZYCLI_LISTEN_FDS"
+	// envReadyFd 子进程就绪后写入的管道 fd
+	envReadyFd = "ZYCLI_READY_FD"
+)
+
+// sigUpgrade 触发平滑升级的信号
+var sigUpgrade os.Signal = syscall.SIGUSR2
+
+// handover 升级时交接给新进程的文件,closer 为主函数重启时需要关闭的监听
+type handover struct {
+	key    string
+	file   func() (*os.File, error)
+	closer io.Closer
+}
+
+var (
+	inheritOnce sync.Once
+	inherited   map[string]*os.File
+	readyFile   *os.File
+	handoverMu  sync.Mutex
+	handovers   []handover
+)
+
+// loadInherited 读取父进程交接的监听和就绪管道
+func loadInherited() {
+	inheritOnce.Do(func() {
+		inherited = map[string]*os.File{}
+		if v := os.Getenv(envListenFds); v != "" {
+			for i, key := range strings.Split(v, ",") {
+				inherited[key] = os.NewFile(uintptr(3+i), key)
+			}
+		}
+		if fd := os.Getenv(envReadyFd); fd != "" {
+			readyFile = os.NewFile(uintptr(tools.AtoI(fd)), "ready")
+		}
+		os.Unsetenv(envListenFds)
+		os.Unsetenv(envReadyFd)
+	})
+}
+
+// inheritFile 取出父进程交接的文件
+func inheritFile(key string) (*os.File, bool) {
+	loadInherited()
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	f, ok := inherited[key]
+	delete(inherited, key)
+	return f, ok
+}
+
+// inheritListener 取出父进程交接的监听
+func inheritListener(network, addr string) (net.Listener, bool) {
+	f, ok := inheritFile(listenKey(network, addr))
+	if !ok {
+		return nil, false
+	}
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		logger.Errorw("inherit listener", "network", network, "addr", addr, "err", err)
+		return nil, false
+	}
+	logger.Infow("inherit listener", "network", network, "addr", addr)
+	return l, true
+}
+
+// Listen 创建监听,平滑升级时由新进程继承,不需要重新绑定端口
+func Listen(network, addr string) (net.Listener, error) {
+	l, ok := inheritListener(network, addr)
+	if !ok {
+		var err error
+		if l, err = net.Listen(network, addr); err != nil {
+			return nil, err
+		}
+	}
+	addHandover(listenKey(network, addr), l)
+	return l, nil
+}
+
+func addHandover(key string, l net.Listener) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return
+	}
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	handovers = append(handovers, handover{key: key, file: fl.File, closer: l})
+}
+
+// handoverMark 返回当前交接列表的长度,用于主函数重启时回滚
+func handoverMark() int {
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	return len(handovers)
+}
+
+// resetHandovers 关闭并移除 mark 之后注册的监听
+func resetHandovers(mark int) {
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	for _, h := range handovers[mark:] {
+		if h.closer != nil {
+			h.closer.Close()
+		}
+	}
+	handovers = handovers[:mark]
+}
+
+// addHandoverFile 交接普通文件,新进程与当前进程共享同一个打开的文件(包括文件锁)
+func addHandoverFile(key string, f *os.File) {
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	handovers = append(handovers, handover{key: key, file: func() (*os.File, error) {
+		fd, err := syscall.Dup(int(f.Fd()))
+		if err != nil {
+			return nil, err
+		}
+		return os.NewFile(uintptr(fd), key), nil
+	}})
+}
+
+// notifyParent 通知父进程已就绪,并关闭未使用的继承监听
+func notifyParent() {
+	loadInherited()
+	handoverMu.Lock()
+	for key, f := range inherited {
+		logger.Warnln("inherited listener not used", key)
+		f.Close()
+		delete(inherited, key)
+	}
+	handoverMu.Unlock()
+	if readyFile != nil {
+		readyFile.Write([]byte{1})
+		readyFile.Close()
+		readyFile = nil
+	}
+}
+
+// startUpgrade 启动新的可执行文件并交接监听,等待子进程就绪后返回子进程 pid
+func startUpgrade(timeout time.Duration) (int, error) {
+	// Type=simple 的 systemd 服务无法通过 MAINPID 转交主进程,旧进程退出时新进程会被一起停止
+	if os.Getenv("INVOCATION_ID") != "" && os.Getenv("NOTIFY_SOCKET") == "" {
+		return 0, errors.New("systemd service without NOTIFY_SOCKET, reinstall with Type=notify and NotifyAccess=all to upgrade")
+	}
+	handoverMu.Lock()
+	var keys []string
+	var files []*os.File
+	for _, h := range handovers {
+		f, err := h.file()
+		if err != nil {
+			handoverMu.Unlock()
+			closeFiles(files)
+			return 0, fmt.Errorf("dup listener %s: %w", h.key, err)
+		}
+		keys = append(keys, h.key)
+		files = append(files, f)
+	}
+	handoverMu.Unlock()
+	defer closeFiles(files)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, envListenFds+"=") && !strings.HasPrefix(e, envReadyFd+"=") {
+			env = append(env, e)
+		}
+	}
+	env = append(env,
+		envListenFds+"="+strings.Join(keys, ","),
+		fmt.Sprintf("%s=%d", envReadyFd, 3+len(files)),
+	)
+	c := exec.Command(filepath.Join(tools.CurrentDir(), tools.CurrentName()), os.Args[1:]...)
+	c.Env = env
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.ExtraFiles = append(files, w)
+	err = c.Start()
+	w.Close()
+	if err != nil {
+		return 0, err
+	}
+	logger.Infow("upgrade child started", "pid", c.Process.Pid, "listeners", keys)
+
+	exited := make(chan error, 1)
+	waitDone := make(chan struct{})
+	go func() {
+		exited <- c.Wait()
+		close(waitDone)
+	}()
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := r.Read(buf)
+		ready <- err
+	}()
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = fmt.Errorf("child not ready: %w", err)
+		}
+	case err = <-exited:
+		err = fmt.Errorf("child exited: %v", err)
+	case <-time.After(timeout):
+		err = errors.New("wait child ready timeout")
+	}
+	if err != nil {
+		// 等待子进程退出,之后再恢复 pid 文件
+		c.Process.Kill()
+		<-waitDone
+		return 0, err
+	}
+	// 新进程已接管 IPC socket,退出时不能删除
+	if ul, ok := ulistener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	return c.Process.Pid, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// sigUpgrade windows 下不支持平滑升级
+var sigUpgrade os.Signal
+
+func inheritFile(_ string) (*os.File, bool) {
+	return nil, false
+}
+
+func inheritListener(_, _ string) (net.Listener, bool) {
+	return nil, false
+}
+
+// windows 下只记录监听,主函数重启时关闭
+var (
+	handoverMu sync.Mutex
+	handovers  []net.Listener
+)
+
+// Listen 创建监听,windows 下不支持平滑升级交接
+func Listen(network, addr string) (net.Listener, error) {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	addHandover(listenKey(network, addr), l)
+	return l, nil
+}
+
+func addHandover(_ string, l net.Listener) {
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	handovers = append(handovers, l)
+}
+
+func handoverMark() int {
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	return len(handovers)
+}
+
+func resetHandovers(mark int) {
+	handoverMu.Lock()
+	defer handoverMu.Unlock()
+	for _, l := range handovers[mark:] {
+		l.Close()
+	}
+	handovers = handovers[:mark]
+}
+
+func addHandoverFile(_ string, _ *os.File) {}
+
+func notifyParent() {}
+
+func startUpgrade(_ time.Duration) (int, error) {
+	return 0, errors.New("upgrade not supported on windows")
+}
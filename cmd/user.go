@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/zhiyin2021/zycli/tools"
+)
+
+// envIpcPath 指定 IPC socket 路径,用户服务通过该变量使用 $XDG_RUNTIME_DIR
+const envIpcPath = "ZYCLI_IPC"
+
+// userMode 以当前用户身份安装和管理服务(systemctl --user)
+var userMode bool
+
+// userRuntimeDir 用户运行时目录
+func userRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+	return "/run/user/" + strconv.Itoa(os.Getuid())
+}
+
+// userIpcPath 用户服务的 IPC socket 路径
+func userIpcPath() string {
+	return filepath.Join(userRuntimeDir(), svcName()+".ipc")
+}
+
+// binPath 安装时创建的程序链接路径
+func binPath() string {
+	if userMode {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, ".local", "bin", tools.CurrentName())
+	}
+	return "/usr/sbin/" + tools.CurrentName()
+}
+
+// resolveIpcPath 按 $ZYCLI_IPC,--user,默认路径的顺序确定 IPC socket 路径
+// 非 root 用户未指定 --user 时,默认 socket 不存在而用户服务 socket 存在则使用后者
+func resolveIpcPath() {
+	if path := os.Getenv(envIpcPath); path != "" {
+		defOpt.ipcPath = path
+		return
+	}
+	if userMode {
+		defOpt.ipcPath = userIpcPath()
+		return
+	}
+	if os.Geteuid() > 0 && !tools.FileExists(defOpt.ipcPath) && tools.FileExists(userIpcPath()) {
+		defOpt.ipcPath = userIpcPath()
+	}
+}
+
+func init() {
+	RootCmd.PersistentFlags().BoolVar(&userMode, "user", false, "manage per-user service with systemctl --user")
+}
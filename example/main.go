@@ -9,7 +9,6 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/zhiyin2021/zycli/cmd"
 	"github.com/zhiyin2021/zycli/resp"
-	"github.com/zhiyin2021/zycli/tools"
 	"github.com/zhiyin2021/zycli/tools/logger"
 )
 
@@ -21,7 +20,7 @@ type Config struct {
 var config Config
 
 func main() {
-	cmd.Execute(run, cmd.WithRegSvc())
+	cmd.Execute(run, cmd.WithRegSvc(), cmd.WithWatchdog(30*time.Second, nil))
 }
 
 func run(args []string) {
@@ -32,7 +31,16 @@ func run(args []string) {
 
 	e.GET("/", helloworld)
 	e.GET("/test", testPanic)
+	l, err := cmd.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorln("listen", err)
+		return
+	}
+	e.Listener = l
 	go e.Start(addr)
+	cmd.OnShutdown("http", 0, 10*time.Second, e.Shutdown)
+	// WithWatchdog 需要主函数通知就绪
+	cmd.Ready()
 }
 
 func helloworld(ctx echo.Context) error {
@@ -52,7 +60,10 @@ func testPanic(ctx echo.Context) error {
 }
 func initConfig() {
 	var err error
-	config, err = tools.LoadConfig[Config]("config.json", json.Unmarshal)
+	config, err = cmd.RegisterConfig("config.json", json.Unmarshal, func(old, new Config) {
+		logger.Infoln("config reload", old.Port, "=>", new.Port)
+		config = new
+	})
 	if err != nil {
 		logger.Warnln("load config", err)
 		config = Config{
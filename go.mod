@@ -1,6 +1,6 @@
 module github.com/zhiyin2021/zycli
 
-go 1.18
+go 1.22
 
 require (
 	github.com/go-playground/locales v0.14.1
@@ -8,8 +8,10 @@ require (
 	github.com/go-playground/validator/v10 v10.24.0
 	github.com/google/uuid v1.6.0
 	github.com/json-iterator/go v1.1.12
+	github.com/klauspost/compress v1.18.0
 	github.com/labstack/echo/v4 v4.13.3
 	github.com/spf13/cobra v1.8.1
+	github.com/ulikunitz/xz v0.5.12
 	go.uber.org/zap v1.27.0
 	golang.org/x/sys v0.29.0
 	gorm.io/gorm v1.25.12
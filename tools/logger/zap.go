@@ -103,7 +103,7 @@ func SetLogger(w io.Writer) {
 			zapcore.AddSync(os.Stdout), // 输出到标准输出
 			zapcore.AddSync(w),         // 输出到文件
 		),
-		zapcore.InfoLevel,
+		atomicLevel, // 日志级别
 	)
 	logger := zap.New(core)
 	sugar = logger.Sugar()
@@ -112,3 +112,7 @@ func SetLogger(w io.Writer) {
 func SetLevel(level zapcore.Level) {
 	atomicLevel.SetLevel(level)
 }
+
+func GetLevel() zapcore.Level {
+	return atomicLevel.Level()
+}